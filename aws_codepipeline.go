@@ -74,6 +74,29 @@ func AddECSDeployAction(actions pipeline.PipelineStageActionArray, ecsCluster st
 	})
 }
 
+// AddCodeDeployToECSAction deploys with the taskdef.json, appspec.yaml and
+// imageDetail.json of the build artifact, see BlueGreenBuildSpecTemplate.
+func AddCodeDeployToECSAction(actions pipeline.PipelineStageActionArray, application string, deploymentGroup string) pipeline.PipelineStageActionArray {
+	return append(actions, pipeline.PipelineStageActionArgs{
+		Name:     plm.String("Deploy"),
+		Category: plm.String("Deploy"),
+		Configuration: plm.StringMap{
+			"ApplicationName":                plm.String(application),
+			"DeploymentGroupName":            plm.String(deploymentGroup),
+			"TaskDefinitionTemplateArtifact": plm.String("BuildArtifact"),
+			"TaskDefinitionTemplatePath":     plm.String("taskdef.json"),
+			"AppSpecTemplateArtifact":        plm.String("BuildArtifact"),
+			"AppSpecTemplatePath":            plm.String("appspec.yaml"),
+			"Image1ArtifactName":             plm.String("BuildArtifact"),
+			"Image1ContainerName":            plm.String("IMAGE1_NAME"),
+		},
+		InputArtifacts: plm.StringArray{plm.String("BuildArtifact")},
+		Owner:          plm.String("AWS"),
+		Provider:       plm.String("CodeDeployToECS"),
+		Version:        plm.String("1"),
+	})
+}
+
 func AddGithubSourceAction(actions pipeline.PipelineStageActionArray, gitRepo string, gitBranch string, gitPolling bool) pipeline.PipelineStageActionArray {
 	return append(actions, pipeline.PipelineStageActionArgs{
 		Name:            plm.String("Source"),
@@ -4,12 +4,47 @@ import (
 	"fmt"
 	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/ecs"
 	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
-	"strings"
+	"sort"
 )
 
-func NewEcsCluster(ctx *plm.Context, service string) (*ecs.Cluster, error) {
+// Capacity providers every Fargate cluster has.
+const (
+	FARGATE      = "FARGATE"
+	FARGATE_SPOT = "FARGATE_SPOT"
+)
+
+// CapacityProviderStrategy runs the first Base tasks on CapacityProvider and
+// spreads the others among the providers of a strategy by Weight.
+type CapacityProviderStrategy struct {
+	CapacityProvider string `json:"capacity-provider"`
+	Base             int    `json:"base"`
+	Weight           int    `json:"weight"`
+}
+
+// NewEcsCluster declares a cluster with the FARGATE and FARGATE_SPOT
+// capacity providers. Services without a launch type or strategy of their
+// own use strategies, or FARGATE only when there are none.
+func NewEcsCluster(ctx *plm.Context, service string, strategies ...CapacityProviderStrategy) (*ecs.Cluster, error) {
+	if len(strategies) == 0 {
+		strategies = []CapacityProviderStrategy{{CapacityProvider: FARGATE, Weight: 1}}
+	}
+	if err := checkCapacityProviderStrategies(strategies); err != nil {
+		return nil, err
+	}
+
+	var defaults ecs.ClusterDefaultCapacityProviderStrategyArray
+	for _, s := range strategies {
+		defaults = append(defaults, ecs.ClusterDefaultCapacityProviderStrategyArgs{
+			CapacityProvider: plm.String(s.CapacityProvider),
+			Base:             plm.IntPtr(s.Base),
+			Weight:           plm.IntPtr(s.Weight),
+		})
+	}
+
 	cluster, err := ecs.NewCluster(ctx, service, &ecs.ClusterArgs{
-		Name: plm.StringPtr(service),
+		Name:                              plm.StringPtr(service),
+		CapacityProviders:                 plm.StringArray{plm.String(FARGATE), plm.String(FARGATE_SPOT)},
+		DefaultCapacityProviderStrategies: defaults,
 		Settings: ecs.ClusterSettingArray{
 			ecs.ClusterSettingArgs{
 				Name:  plm.String("containerInsights"),
@@ -24,36 +59,89 @@ func NewEcsCluster(ctx *plm.Context, service string) (*ecs.Cluster, error) {
 	return cluster, nil
 }
 
-func ContainerEnvs(appEnvs map[string]string) []string {
-	var envs []string
-	for k, v := range appEnvs {
-		envs = append(envs, ContainerEnv(k, v))
+// serviceCapacityProviderStrategies returns the strategies of a service,
+// which are nil for services that set a launch type instead.
+func serviceCapacityProviderStrategies(strategies []CapacityProviderStrategy) (ecs.ServiceCapacityProviderStrategyArrayInput, error) {
+	if len(strategies) == 0 {
+		return nil, nil
+	}
+	if err := checkCapacityProviderStrategies(strategies); err != nil {
+		return nil, err
+	}
+
+	var res ecs.ServiceCapacityProviderStrategyArray
+	for _, s := range strategies {
+		res = append(res, ecs.ServiceCapacityProviderStrategyArgs{
+			CapacityProvider: plm.String(s.CapacityProvider),
+			Base:             plm.IntPtr(s.Base),
+			Weight:           plm.IntPtr(s.Weight),
+		})
+	}
+	return res, nil
+}
+
+// checkCapacityProviderStrategies applies the rules of ECS: a single base,
+// and at least one provider with a weight.
+func checkCapacityProviderStrategies(strategies []CapacityProviderStrategy) error {
+	bases, weighted := 0, false
+	for _, s := range strategies {
+		if s.CapacityProvider == "" {
+			return fmt.Errorf("capacity provider strategy: a capacity provider is required")
+		}
+		if s.Base < 0 || s.Base > 100000 || s.Weight < 0 || s.Weight > 1000 {
+			return fmt.Errorf("capacity provider strategy %v: base %v or weight %v out of range", s.CapacityProvider, s.Base, s.Weight)
+		}
+		if s.Base > 0 {
+			bases++
+		}
+		weighted = weighted || s.Weight > 0
+	}
+	if bases > 1 {
+		return fmt.Errorf("capacity provider strategy: only one provider can have a base")
+	}
+	if !weighted {
+		return fmt.Errorf("capacity provider strategy: at least one provider needs a weight")
+	}
+	return nil
+}
+
+// ContainerEnvs returns the env vars sorted by name, so that the rendered
+// task definition does not change between runs.
+func ContainerEnvs(appEnvs map[string]string) []KeyValuePair {
+	var envs []KeyValuePair
+	for _, k := range sortedNames(appEnvs) {
+		envs = append(envs, ContainerEnv(k, appEnvs[k]))
 	}
 	return envs
 }
 
-func ContainerEnv(key string, value string) string {
-	return fmt.Sprintf(`{
-	"name": "%v",
-	"value": "%v"
-	}`, key, value)
+func ContainerEnv(key string, value string) KeyValuePair {
+	return KeyValuePair{Name: key, Value: value}
 }
 
-func ContainerSecret(secretArn *string, secret string) string {
-	return fmt.Sprintf(`{
-	"valueFrom": "%v:%v::",
-	"name": "%v"
-	}`, *secretArn, secret, secret)
+// ContainerSecret reads the key secret of the Secrets Manager secret
+// secretArn.
+func ContainerSecret(secretArn *string, secret string) Secret {
+	return Secret{
+		Name:      secret,
+		ValueFrom: fmt.Sprintf("%v:%v::", *secretArn, secret),
+	}
 }
 
-func ContainerSecrets(appSecrets map[string]string, secretArn *string) []string {
-	var secrets []string
-	for k := range appSecrets {
+// ContainerSecrets returns the secrets sorted by name, like ContainerEnvs.
+func ContainerSecrets(appSecrets map[string]string, secretArn *string) []Secret {
+	var secrets []Secret
+	for _, k := range sortedNames(appSecrets) {
 		secrets = append(secrets, ContainerSecret(secretArn, k))
 	}
 	return secrets
 }
 
-func ContainerEnvJsonArray(envs []string) string {
-	return strings.Join(envs, ",")
+func sortedNames(m map[string]string) []string {
+	var names []string
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
 }
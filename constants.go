@@ -17,3 +17,7 @@ const ECR_LIFECYCLE_POLICY = `
         }
     ]
 }`
+
+// AUTO_TAG_CONFIG_NAMESPACE is the stack config namespace the components read
+// their auto tags, tag policy and ignore rules from.
+const AUTO_TAG_CONFIG_NAMESPACE = "dulumi"
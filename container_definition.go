@@ -0,0 +1,189 @@
+package dulumi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ContainerDefinition is one container of an ECS task definition, with the
+// fields of the ECS API that the components use.
+type ContainerDefinition struct {
+	Name                  string                 `json:"name"`
+	Image                 string                 `json:"image"`
+	Cpu                   *int                   `json:"cpu,omitempty"`
+	Memory                *int                   `json:"memory,omitempty"`
+	User                  string                 `json:"user,omitempty"`
+	Essential             *bool                  `json:"essential,omitempty"`
+	PortMappings          []PortMapping          `json:"portMappings,omitempty"`
+	DependsOn             []ContainerDependency  `json:"dependsOn,omitempty"`
+	Environment           []KeyValuePair         `json:"environment,omitempty"`
+	Secrets               []Secret               `json:"secrets,omitempty"`
+	Ulimits               []Ulimit               `json:"ulimits,omitempty"`
+	HealthCheck           *HealthCheck           `json:"healthCheck,omitempty"`
+	LogConfiguration      *LogConfiguration      `json:"logConfiguration,omitempty"`
+	FirelensConfiguration *FirelensConfiguration `json:"firelensConfiguration,omitempty"`
+}
+
+type PortMapping struct {
+	ContainerPort int    `json:"containerPort"`
+	HostPort      int    `json:"hostPort,omitempty"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// ContainerDependency delays a container until ContainerName reaches
+// Condition: START, COMPLETE, SUCCESS or HEALTHY.
+type ContainerDependency struct {
+	ContainerName string `json:"containerName"`
+	Condition     string `json:"condition"`
+}
+
+type KeyValuePair struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Secret sets the env var Name from a secret, e.g. a key of a Secrets
+// Manager secret.
+type Secret struct {
+	Name      string `json:"name"`
+	ValueFrom string `json:"valueFrom"`
+}
+
+type Ulimit struct {
+	Name      string `json:"name"`
+	SoftLimit int    `json:"softLimit"`
+	HardLimit int    `json:"hardLimit"`
+}
+
+// HealthCheck durations are in seconds.
+type HealthCheck struct {
+	Command     []string `json:"command"`
+	Interval    int      `json:"interval,omitempty"`
+	Timeout     int      `json:"timeout,omitempty"`
+	Retries     int      `json:"retries,omitempty"`
+	StartPeriod int      `json:"startPeriod,omitempty"`
+}
+
+// HttpHealthCheck curls path on port from inside the container, which needs
+// curl in its image.
+func HttpHealthCheck(port int, path string) HealthCheck {
+	return HealthCheck{
+		Command:  []string{"CMD-SHELL", fmt.Sprintf("curl -fs http://localhost:%v%v || exit 1", port, path)},
+		Interval: 30,
+		Timeout:  5,
+		Retries:  3,
+	}
+}
+
+// withDefaults fills the fields left unset from defaults and checks the
+// result against the limits of ECS.
+func (h HealthCheck) withDefaults(defaults HealthCheck) (HealthCheck, error) {
+	if len(h.Command) == 0 {
+		h.Command = defaults.Command
+	}
+	if h.Interval == 0 {
+		h.Interval = defaults.Interval
+	}
+	if h.Timeout == 0 {
+		h.Timeout = defaults.Timeout
+	}
+	if h.Retries == 0 {
+		h.Retries = defaults.Retries
+	}
+	if h.StartPeriod == 0 {
+		h.StartPeriod = defaults.StartPeriod
+	}
+
+	switch {
+	case h.Interval < 5 || h.Interval > 300:
+		return h, fmt.Errorf("health check interval %v is not within 5 and 300 seconds", h.Interval)
+	case h.Timeout < 2 || h.Timeout > 60:
+		return h, fmt.Errorf("health check timeout %v is not within 2 and 60 seconds", h.Timeout)
+	case h.Timeout >= h.Interval:
+		return h, fmt.Errorf("health check timeout %v is not shorter than its interval %v", h.Timeout, h.Interval)
+	case h.Retries < 1 || h.Retries > 10:
+		return h, fmt.Errorf("health check retries %v is not within 1 and 10", h.Retries)
+	case h.StartPeriod < 0 || h.StartPeriod > 300:
+		return h, fmt.Errorf("health check start period %v is not within 0 and 300 seconds", h.StartPeriod)
+	}
+	return h, nil
+}
+
+type LogConfiguration struct {
+	LogDriver string            `json:"logDriver"`
+	Options   map[string]string `json:"options,omitempty"`
+}
+
+type FirelensConfiguration struct {
+	Type    string            `json:"type"`
+	Options map[string]string `json:"options,omitempty"`
+}
+
+// Sidecar is an extra container of a FargateApi task, such as a monitoring
+// agent or a proxy.
+type Sidecar struct {
+	Name   string `json:"name"`
+	Image  string `json:"image"`
+	Cpu    *int   `json:"cpu"`
+	Memory *int   `json:"memory"`
+	// Essential defaults to true, as in ECS: the task stops when the sidecar
+	// does.
+	Essential *bool             `json:"essential"`
+	Envs      map[string]string `json:"envs"`
+	// Secrets maps env var names to the ARNs they are read from.
+	Secrets      map[string]string     `json:"secrets"`
+	PortMappings []PortMapping         `json:"port-mappings"`
+	DependsOn    []ContainerDependency `json:"depends-on"`
+	// LogConfiguration defaults to the one of the app container, with the
+	// sidecar name as awslogs stream prefix.
+	LogConfiguration *LogConfiguration `json:"log-configuration"`
+}
+
+// ContainerDefinition returns the definition of the sidecar container.
+func (s Sidecar) ContainerDefinition() ContainerDefinition {
+	var secrets []Secret
+	for _, k := range sortedNames(s.Secrets) {
+		secrets = append(secrets, Secret{Name: k, ValueFrom: s.Secrets[k]})
+	}
+	return ContainerDefinition{
+		Name:             s.Name,
+		Image:            s.Image,
+		Cpu:              s.Cpu,
+		Memory:           s.Memory,
+		Essential:        s.Essential,
+		PortMappings:     s.PortMappings,
+		DependsOn:        s.DependsOn,
+		Environment:      ContainerEnvs(s.Envs),
+		Secrets:          secrets,
+		LogConfiguration: s.LogConfiguration,
+	}
+}
+
+// MarshalContainerDefinitions renders the container definitions of a task
+// definition, after checking that their names are unique and their
+// dependencies exist.
+func MarshalContainerDefinitions(definitions []ContainerDefinition) (string, error) {
+	names := map[string]bool{}
+	for _, d := range definitions {
+		if d.Name == "" || d.Image == "" {
+			return "", fmt.Errorf("container definition %q: name and image are required", d.Name)
+		}
+		if names[d.Name] {
+			return "", fmt.Errorf("container definition %q: duplicate name", d.Name)
+		}
+		names[d.Name] = true
+	}
+	for _, d := range definitions {
+		for _, dep := range d.DependsOn {
+			if !names[dep.ContainerName] {
+				return "", fmt.Errorf("container definition %q: depends on unknown container %q", d.Name, dep.ContainerName)
+			}
+		}
+	}
+
+	b, err := json.MarshalIndent(definitions, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("marshal container definitions: %w", err)
+	}
+	return string(b), nil
+}
@@ -3,6 +3,7 @@ package dulumi
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws"
 	aas "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/appautoscaling"
 	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/cloudwatch"
 	build "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/codebuild"
@@ -17,6 +18,7 @@ import (
 	"github.com/sallgoood/dulumi/utils"
 	"log"
 	"strconv"
+	"time"
 )
 
 type FargateApi struct {
@@ -31,29 +33,108 @@ type FargateApiArgs struct {
 	EnvLong string `json:"env-long"`
 	VPCId   string `json:"vpc-id"`
 
+	// AWSAccountId and AWSRegion locate the ECR registry and the CloudWatch
+	// logs. Each defaults to the one of the active provider.
+	AWSAccountId string `json:"aws-account-id"`
+	AWSRegion    string `json:"aws-region"`
+
 	LBSubnetIPs        []string `json:"lb-subnet-ids"`
 	LBSecurityGroupIds []string `json:"lb-security-group-ids"`
 
 	LBCertificateArn string `json:"lb-certificate-arn"`
-	LBDomain         string `json:"lb-domain"`
-	LBSubDomain      string `json:"lb-subdomain"`
+	// LBDomain and LBSubDomain name the DNS record of the API, an alias of
+	// its load balancer declared in the hosted zone LBDomain when both are
+	// set.
+	LBDomain    string `json:"lb-domain"`
+	LBSubDomain string `json:"lb-subdomain"`
+	// LBInternal keeps the load balancer off the internet. Its DNS record
+	// then goes into the private hosted zone LBDomain of the VPC.
+	LBInternal bool `json:"lb-internal"`
+
+	// SharedAlb attaches the API to a load balancer declared by NewSharedAlb
+	// with LBRule, instead of declaring one with the LB fields above.
+	SharedAlb *SharedAlb   `json:"-"`
+	LBRule    ListenerRule `json:"lb-rule"`
 
 	ECSTaskSubnetIds        []string `json:"ecs-task-subnet-ids"`
 	ECSTaskSecurityGroupIds []string `json:"ecs-task-security-group-ids"`
 	ECSTaskRole             string   `json:"ecs-task-role"`
-	ECSExecutionRole        string   `json:"ecs-execution-role"`
+	// ECSTaskAssignPublicIp defaults to true, unless the load balancer is
+	// internal. Tasks without public IPs reach the internet through a NAT.
+	ECSTaskAssignPublicIp *bool  `json:"ecs-task-assign-public-ip"`
+	ECSExecutionRole      string `json:"ecs-execution-role"`
+	// ECSDesiredCount is the number of tasks the service starts with,
+	// defaulting to 1. Later changes are left to the autoscaling.
+	ECSDesiredCount int `json:"ecs-desired-count"`
+	// ECSDeploymentMinimumHealthyPercent and ECSDeploymentMaximumPercent
+	// bound the running tasks during a rolling update, as percents of the
+	// desired count. They default to those of ECS, 100 and 200.
+	//
+	// The deployment circuit breaker, which rolls back a rolling update whose
+	// tasks fail to start, is not set: ecs.ServiceArgs of pulumi-aws v3.8.0
+	// has no DeploymentCircuitBreaker, and it needs a newer v3 release.
+	ECSDeploymentMinimumHealthyPercent *int `json:"ecs-deployment-minimum-healthy-percent"`
+	ECSDeploymentMaximumPercent        *int `json:"ecs-deployment-maximum-percent"`
+	// ECSHealthCheckGracePeriod ignores the target group health checks of
+	// new tasks for as many seconds.
+	ECSHealthCheckGracePeriod int `json:"ecs-health-check-grace-period"`
+	// ECSIgnoreTaskDefinitionChanges leaves the task definition of the
+	// service to the pipeline. The pipeline deploys new revisions of the
+	// task definition the service runs, so without it every update resets
+	// the service to the revision Pulumi declares, restarting the tasks on
+	// the latest image. With it, changes to the declared task definition,
+	// such as the cpu, memory or environment, only reach the service with
+	// the next deployment after them. Blue/green services always leave the
+	// task definition to CodeDeploy.
+	ECSIgnoreTaskDefinitionChanges bool `json:"ecs-ignore-task-definition-changes"`
+	// ECSCapacityProviderStrategy runs the tasks on capacity providers, e.g.
+	// mostly FARGATE_SPOT, instead of the FARGATE launch type. Switching
+	// between the two replaces the service.
+	ECSCapacityProviderStrategy []CapacityProviderStrategy `json:"ecs-capacity-provider-strategy"`
 
 	AppPort            int               `json:"app-port"`
 	AppSecrets         map[string]string `json:"app-secrets"`
 	AppEnvs            map[string]string `json:"app-envs"`
 	AppHealthCheckPath string            `json:"app-health-check-path"`
-	AppScaleCpuPercent float64           `json:"app-scale-cpu-percent"`
-	AppScaleMin        int               `json:"app-scale-min"`
-	AppScaleMax        int               `json:"app-scale-max"`
-	AppCpu             string            `json:"app-cpu"`
-	AppMemory          string            `json:"app-memory"`
-	AppEnableLogRouter bool              `json:"app-enable-logrouter"`
-	AppLogRouterEnvs   map[string]string `json:"app-logrouter-envs"`
+	// AppHealthCheck overrides fields of the default health check, a curl of
+	// AppHealthCheckPath on AppPort. The target group checks the same path
+	// with the same interval, timeout and retries.
+	AppHealthCheck     *HealthCheck `json:"app-health-check"`
+	AppScaleCpuPercent float64      `json:"app-scale-cpu-percent"`
+	AppScaleMin        int          `json:"app-scale-min"`
+	AppScaleMax        int          `json:"app-scale-max"`
+	// AppScaleMemoryPercent and AppScaleRequestsPerTarget add target tracking
+	// policies on the memory and on the ALB requests per task, next to the
+	// one on the CPU. Each is off at 0. The requests are those of the blue
+	// target group, so AppScaleRequestsPerTarget is rejected with BlueGreen.
+	AppScaleMemoryPercent     float64 `json:"app-scale-memory-percent"`
+	AppScaleRequestsPerTarget float64 `json:"app-scale-requests-per-target"`
+	// AppScaleInCooldown and AppScaleOutCooldown are the cooldowns of the
+	// target tracking policies, 30 and 1 seconds by default.
+	AppScaleInCooldown  *int          `json:"app-scale-in-cooldown"`
+	AppScaleOutCooldown *int          `json:"app-scale-out-cooldown"`
+	AppScaleSteps       []StepScaling `json:"app-scale-steps"`
+	// AppScaleSchedules change AppScaleMin and AppScaleMax on schedules read in
+	// AppScaleTimeZone. Once there is any schedule, the schedules own the
+	// capacity: later edits to AppScaleMin and AppScaleMax are no longer
+	// applied to the scalable target.
+	AppScaleSchedules []ScheduledScaling `json:"app-scale-schedules"`
+	// AppScaleTimeZone is an IANA time zone name that defaults to UTC. The
+	// schedules are converted to UTC with the offset of the zone at the time
+	// of the update, as the scheduled actions of this pulumi-aws version
+	// have no time zone. cron() schedules are therefore rejected in zones
+	// with daylight saving time, such as Europe/Berlin, unless
+	// AppScaleDaylightSaving accepts that after a change they run an hour
+	// off until the next update, which then shows them as changed.
+	AppScaleTimeZone       string            `json:"app-scale-time-zone"`
+	AppScaleDaylightSaving bool              `json:"app-scale-daylight-saving"`
+	AppCpu                 string            `json:"app-cpu"`
+	AppMemory              string            `json:"app-memory"`
+	AppEnableLogRouter     bool              `json:"app-enable-logrouter"`
+	AppLogRouterEnvs       map[string]string `json:"app-logrouter-envs"`
+	// AppLogRouterImage defaults to drama-aws-fluent-bit in the ECR registry.
+	AppLogRouterImage string    `json:"app-logrouter-image"`
+	AppSidecars       []Sidecar `json:"app-sidecars"`
 
 	GitRepo   string `json:"git-repo"`
 	GitBranch string `json:"git-branch"`
@@ -64,6 +145,9 @@ type FargateApiArgs struct {
 	CICDRequireApproval     bool                `json:"cicd-require-approval"`
 	CICDRequireNotification bool                `json:"cicd-require-notification"`
 	CICDBuildEnvs           []map[string]string `json:"cicd-build-envs"`
+
+	// BlueGreen deploys with CodeDeploy instead of ECS rolling updates.
+	BlueGreen *BlueGreenArgs `json:"blue-green"`
 }
 
 type Ignore struct {
@@ -72,103 +156,169 @@ type Ignore struct {
 	Props  []string
 }
 
-func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
+// NewFargateApi declares a Fargate API whose children are named after name.
+// Stacks created before instances were named pass FARGATE_API_LEGACY_NAME.
+func NewFargateApi(ctx *plm.Context, name string, c FargateApiArgs,
 	ignore Ignore,
 	opts ...plm.ResourceOption,
 ) (*FargateApi, error) {
-	utils.RegisterAutoTags(ctx, plm.StringMap{
-		"Role":        plm.String("infra"),
-		"Environment": plm.String(c.Env),
-		"Service":     plm.String(c.Product),
-		"Team":        plm.String("dev"),
-	})
-
-	utils.IgnoreChanges(ctx, ignore.Global, ignore.Types, ignore.Props)
+	tagConfig, tagging, err := componentTagging(ctx, c.Env, c.Product)
+	if err != nil {
+		return nil, err
+	}
+	tagConfig.IgnoreChanges = append(tagConfig.IgnoreChanges,
+		utils.IgnoreRule{Global: ignore.Global, Types: ignore.Types, Props: ignore.Props})
 
 	var dfa FargateApi
-	err := ctx.RegisterComponentResource("drama:server:fargate-api", "drama-fargate-api", &dfa, opts...)
+	err = ctx.RegisterComponentResource(fargateApiType, name, &dfa,
+		append(opts, plm.Transformations([]plm.ResourceTransformation{tagging}))...)
 	if err != nil {
 		return nil, err
 	}
 
+	children := newChildNames(ctx, &dfa, fargateApiType, tagConfig, name, FARGATE_API_LEGACY_NAME)
 	productEnv := fmt.Sprintf("%v-%v", c.Product, c.Env)
 
-	cluster, err := ecs.LookupCluster(ctx, &ecs.LookupClusterArgs{
-		ClusterName: c.Product,
-	})
+	account, region, err := awsAccountRegion(ctx, c, plm.Parent(&dfa))
 	if err != nil {
 		return nil, err
 	}
+	registry := fmt.Sprintf("%v.dkr.ecr.%v.amazonaws.com", account, region)
 
-	lb, err := alb.NewLoadBalancer(ctx, "alb", &alb.LoadBalancerArgs{
-		Name:           plm.String(productEnv),
-		Subnets:        utils.ToPulumiStringArray(c.LBSubnetIPs),
-		SecurityGroups: utils.ToPulumiStringArray(c.LBSecurityGroupIds),
-	}, plm.Parent(&dfa))
+	logRouterImage := c.AppLogRouterImage
+	if logRouterImage == "" {
+		logRouterImage = fmt.Sprintf("%v/drama-aws-fluent-bit:latest", registry)
+	}
+
+	healthCheck, err := appHealthCheck(c)
 	if err != nil {
 		return nil, err
 	}
-	tg, err := alb.NewTargetGroup(ctx, "targetGroup", &alb.TargetGroupArgs{
-		Name:                plm.String(productEnv),
-		Port:                plm.Int(c.AppPort),
-		Protocol:            plm.String("HTTP"),
-		TargetType:          plm.String("ip"),
-		VpcId:               plm.String(c.VPCId),
-		DeregistrationDelay: plm.Int(1),
-		HealthCheck: alb.TargetGroupHealthCheckArgs{
-			Enabled:            plm.BoolPtr(true),
-			HealthyThreshold:   plm.IntPtr(3),
-			UnhealthyThreshold: plm.IntPtr(3),
-			Interval:           plm.IntPtr(30),
-			Matcher:            plm.StringPtr("200-399"),
-			Path:               plm.StringPtr(c.AppHealthCheckPath),
-			Port:               plm.StringPtr(strconv.Itoa(c.AppPort)),
-			Protocol:           plm.StringPtr("HTTP"),
-			Timeout:            plm.IntPtr(5),
-		},
-	}, plm.Parent(&dfa))
+
+	if err := checkDeploymentArgs(c); err != nil {
+		return nil, err
+	}
+	capacityProviderStrategies, err := serviceCapacityProviderStrategies(c.ECSCapacityProviderStrategy)
 	if err != nil {
 		return nil, err
 	}
-	_, err = alb.NewListener(ctx, "httpListener", &alb.ListenerArgs{
-		LoadBalancerArn: lb.Arn,
-		Port:            plm.Int(80),
-		DefaultActions: alb.ListenerDefaultActionArray{
-			alb.ListenerDefaultActionArgs{
-				Type: plm.String("redirect"),
-				Redirect: alb.ListenerDefaultActionRedirectArgs{
-					Port:       plm.StringPtr("443"),
-					Protocol:   plm.StringPtr("HTTPS"),
-					StatusCode: plm.String("HTTP_301"),
-				},
-			},
-		},
-	}, plm.Parent(&dfa))
+	var launchType plm.StringPtrInput
+	if capacityProviderStrategies == nil {
+		launchType = plm.String("FARGATE")
+	}
+
+	var blueGreen BlueGreenArgs
+	if c.BlueGreen != nil && c.SharedAlb != nil {
+		return nil, fmt.Errorf("blue/green deployments need a dedicated load balancer")
+	}
+	if c.BlueGreen != nil && c.AppScaleRequestsPerTarget > 0 {
+		return nil, fmt.Errorf("blue/green deployments cannot scale on the requests per target")
+	}
+	if c.BlueGreen != nil {
+		if blueGreen, err = c.BlueGreen.withDefaults(productEnv); err != nil {
+			return nil, err
+		}
+	}
+
+	cluster, err := ecs.LookupCluster(ctx, &ecs.LookupClusterArgs{
+		ClusterName: c.Product,
+	})
 	if err != nil {
 		return nil, err
 	}
-	https, err := alb.NewListener(
-		ctx,
-		"httpsListener",
-		NewSimpleForwardingHttpsListener(lb, tg, c.LBCertificateArn),
-		plm.Parent(&dfa),
-	)
+
+	var lb *alb.LoadBalancer
+	if c.SharedAlb != nil {
+		lb = c.SharedAlb.LoadBalancer
+	} else {
+		lb, err = alb.NewLoadBalancer(ctx, children.name("alb"), &alb.LoadBalancerArgs{
+			Name:           plm.String(productEnv),
+			Internal:       plm.BoolPtr(c.LBInternal),
+			Subnets:        utils.ToPulumiStringArray(c.LBSubnetIPs),
+			SecurityGroups: utils.ToPulumiStringArray(c.LBSecurityGroupIds),
+		}, children.options("aws:lb/loadBalancer:LoadBalancer", "alb", children.alias("alb"))...)
+		if err != nil {
+			return nil, err
+		}
+	}
+	targetGroupArgs := func(name string) *alb.TargetGroupArgs {
+		return &alb.TargetGroupArgs{
+			Name:                plm.String(name),
+			Port:                plm.Int(c.AppPort),
+			Protocol:            plm.String("HTTP"),
+			TargetType:          plm.String("ip"),
+			VpcId:               plm.String(c.VPCId),
+			DeregistrationDelay: plm.Int(1),
+			HealthCheck: alb.TargetGroupHealthCheckArgs{
+				Enabled:            plm.BoolPtr(true),
+				HealthyThreshold:   plm.IntPtr(3),
+				UnhealthyThreshold: plm.IntPtr(unhealthyThreshold(healthCheck.Retries)),
+				Interval:           plm.IntPtr(healthCheck.Interval),
+				Matcher:            plm.StringPtr("200-399"),
+				Path:               plm.StringPtr(healthCheckPath(c)),
+				Port:               plm.StringPtr(strconv.Itoa(c.AppPort)),
+				Protocol:           plm.StringPtr("HTTP"),
+				Timeout:            plm.IntPtr(healthCheck.Timeout),
+			},
+		}
+	}
+	tg, err := alb.NewTargetGroup(ctx, children.name("targetGroup"), targetGroupArgs(productEnv),
+		children.options("aws:lb/targetGroup:TargetGroup", "targetGroup", children.alias("targetGroup"))...)
 	if err != nil {
 		return nil, err
 	}
+	// routed is the listener or listener rule that sends requests to tg.
+	var routed plm.Resource
+	var https *alb.Listener
+	if c.SharedAlb != nil {
+		routed, err = c.SharedAlb.newListenerRule(ctx, children.name("listenerRule"), c.LBRule, tg,
+			children.options("aws:lb/listenerRule:ListenerRule", "listenerRule")...)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, err = alb.NewListener(ctx, children.name("httpListener"), NewHttpsRedirectListener(lb),
+			children.options("aws:lb/listener:Listener", "httpListener", children.alias("httpListener"))...)
+		if err != nil {
+			return nil, err
+		}
+		https, err = alb.NewListener(
+			ctx,
+			children.name("httpsListener"),
+			NewSimpleForwardingHttpsListener(lb, tg, c.LBCertificateArn),
+			children.options("aws:lb/listener:Listener", "httpsListener",
+				children.alias("httpsListener"),
+				// CodeDeploy switches the target group of the listeners.
+				plm.IgnoreChanges(blueGreenIgnored(c, "defaultActions")),
+			)...,
+		)
+		if err != nil {
+			return nil, err
+		}
+		routed = https
+	}
+
+	var bg *blueGreenDeployment
+	if c.BlueGreen != nil {
+		bg, err = newBlueGreenListener(ctx, children, blueGreen, lb, tg,
+			targetGroupArgs(greenTargetGroupName(productEnv)), c.LBCertificateArn)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	logGroup, err := cloudwatch.NewLogGroup(ctx, "logGroup", &cloudwatch.LogGroupArgs{
+	logGroup, err := cloudwatch.NewLogGroup(ctx, children.name("logGroup"), &cloudwatch.LogGroupArgs{
 		Name:            plm.String(productEnv),
 		RetentionInDays: plm.IntPtr(30),
-	}, plm.Parent(&dfa))
+	}, children.options("aws:cloudwatch/logGroup:LogGroup", "logGroup", children.alias("logGroup"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	secretManager, err := scm.NewSecret(ctx, "secretManager", &scm.SecretArgs{
+	secretManager, err := scm.NewSecret(ctx, children.name("secretManager"), &scm.SecretArgs{
 		Name:                 plm.String(productEnv),
 		RecoveryWindowInDays: plm.Int(0),
-	}, plm.Parent(&dfa))
+	}, children.options("aws:secretsmanager/secret:Secret", "secretManager", children.alias("secretManager"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -178,11 +328,12 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 		return nil, err
 	}
 
-	_, err = scm.NewSecretVersion(ctx, fmt.Sprintf("secrets"), &scm.SecretVersionArgs{
+	_, err = scm.NewSecretVersion(ctx, children.name("secrets"), &scm.SecretVersionArgs{
 		SecretId:     secretManager.ID(),
 		SecretString: plm.ToSecret(plm.String(secretJson)).(plm.StringOutput),
-	}, plm.Parent(&dfa),
-		plm.DependsOn([]plm.Resource{secretManager}))
+	}, children.options("aws:secretsmanager/secretVersion:SecretVersion", "secrets",
+		children.alias("secrets"),
+		plm.DependsOn([]plm.Resource{secretManager}))...)
 	if err != nil {
 		return nil, err
 	}
@@ -197,7 +348,33 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 		secretArn = secretM.Arn
 	}
 
-	initialTask, err := ecs.NewTaskDefinition(ctx, "ecsTaskDefinition", &ecs.TaskDefinitionArgs{
+	var sidecars []ContainerDefinition
+	for _, s := range c.AppSidecars {
+		sidecars = append(sidecars, s.ContainerDefinition())
+	}
+	containerDefinitions, err := ContainerDefinitionTemplate(
+		fmt.Sprintf(
+			"%v/%v:latest",
+			registry,
+			productEnv,
+		),
+		c.AppPort,
+		productEnv,
+		region,
+		c.AppEnvs,
+		&secretArn,
+		c.AppSecrets,
+		c.AppLogRouterEnvs,
+		c.AppEnableLogRouter,
+		logRouterImage,
+		&healthCheck,
+		sidecars...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	initialTask, err := ecs.NewTaskDefinition(ctx, children.name("ecsTaskDefinition"), &ecs.TaskDefinitionArgs{
 		Family:                  plm.String(productEnv),
 		Cpu:                     plm.String(c.AppCpu),
 		Memory:                  plm.String(c.AppMemory),
@@ -205,37 +382,30 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 		RequiresCompatibilities: plm.StringArray{plm.String("FARGATE")},
 		TaskRoleArn:             plm.String(c.ECSTaskRole),
 		ExecutionRoleArn:        plm.String(c.ECSExecutionRole),
-		ContainerDefinitions: plm.String(ContainerDefinitionTemplate(
-			fmt.Sprintf(
-				"%v/%v:latest",
-				"784015586554.dkr.ecr.ap-northeast-1.amazonaws.com",
-				productEnv,
-			),
-			strconv.Itoa(c.AppPort),
-			productEnv,
-			c.AppEnvs,
-			&secretArn,
-			c.AppSecrets,
-			c.AppLogRouterEnvs,
-			c.AppEnableLogRouter,
-		)),
-	}, plm.Parent(&dfa),
-		plm.DependsOn([]plm.Resource{logGroup, secretManager}))
+		ContainerDefinitions:    plm.String(containerDefinitions),
+	}, children.options("aws:ecs/taskDefinition:TaskDefinition", "ecsTaskDefinition",
+		children.alias("ecsTaskDefinition"),
+		plm.DependsOn([]plm.Resource{logGroup, secretManager}))...)
 	if err != nil {
 		return nil, err
 	}
 
-	svc, err := ecs.NewService(ctx, "ecsService", &ecs.ServiceArgs{
+	svc, err := ecs.NewService(ctx, children.name("ecsService"), &ecs.ServiceArgs{
 		Name:           plm.String(productEnv),
 		Cluster:        plm.String(cluster.Arn),
 		TaskDefinition: initialTask.Arn,
-		DesiredCount:   plm.Int(1),
-		LaunchType:     plm.String("FARGATE"),
+		DesiredCount:   plm.Int(desiredCount(c)),
+		LaunchType:     launchType,
+
+		CapacityProviderStrategies:      capacityProviderStrategies,
+		DeploymentMinimumHealthyPercent: intPtr(c.ECSDeploymentMinimumHealthyPercent),
+		DeploymentMaximumPercent:        intPtr(c.ECSDeploymentMaximumPercent),
+		HealthCheckGracePeriodSeconds:   plm.IntPtr(c.ECSHealthCheckGracePeriod),
 		DeploymentController: ecs.ServiceDeploymentControllerArgs{
-			Type: plm.StringPtr("ECS"),
+			Type: plm.StringPtr(deploymentController(c)),
 		},
 		NetworkConfiguration: &ecs.ServiceNetworkConfigurationArgs{
-			AssignPublicIp: plm.Bool(true),
+			AssignPublicIp: plm.Bool(assignPublicIp(c)),
 			Subnets:        utils.ToPulumiStringArray(c.ECSTaskSubnetIds),
 			SecurityGroups: utils.ToPulumiStringArray(c.ECSTaskSecurityGroupIds),
 		},
@@ -246,57 +416,67 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 				ContainerPort:  plm.Int(c.AppPort),
 			},
 		},
-	}, plm.DependsOn([]plm.Resource{https}),
-		plm.Parent(&dfa))
+	}, children.options("aws:ecs/service:Service", "ecsService",
+		plm.DependsOn([]plm.Resource{routed}),
+		children.alias("ecsService"),
+		plm.IgnoreChanges(serviceIgnored(c)))...)
 	if err != nil {
 		return nil, err
 	}
 
+	pipelineDependencies := []plm.Resource{}
+	if bg != nil {
+		if err := bg.newDeploymentGroup(ctx, children, c.Product, productEnv, svc, https, tg); err != nil {
+			return nil, err
+		}
+		pipelineDependencies = append(pipelineDependencies, bg.group)
+	}
+
 	autoscaleResourceId := plm.String(fmt.Sprintf("service/%v/%v", cluster.ClusterName, productEnv))
 
-	_, err = aas.NewTarget(ctx, "autoscaleTarget", &aas.TargetArgs{
+	target, err := aas.NewTarget(ctx, children.name("autoscaleTarget"), &aas.TargetArgs{
 		MaxCapacity:       plm.Int(c.AppScaleMax),
 		MinCapacity:       plm.Int(c.AppScaleMin),
 		ResourceId:        autoscaleResourceId,
 		ScalableDimension: plm.String("ecs:service:DesiredCount"),
 		ServiceNamespace:  plm.String("ecs"),
-	}, plm.Parent(&dfa),
-		plm.DependsOn([]plm.Resource{svc}))
+	}, children.options("aws:appautoscaling/target:Target", "autoscaleTarget",
+		children.alias("autoscaleTarget"),
+		plm.DependsOn([]plm.Resource{svc}),
+		// Scheduled actions own the capacity once there are any.
+		plm.IgnoreChanges(scheduledIgnored(c)))...)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = aas.NewPolicy(ctx, "autoscalePolicy", &aas.PolicyArgs{
-		Name:              plm.String("scale-inout"),
-		PolicyType:        plm.String("TargetTrackingScaling"),
-		ResourceId:        autoscaleResourceId,
-		ScalableDimension: plm.String("ecs:service:DesiredCount"),
-		ServiceNamespace:  plm.String("ecs"),
-		TargetTrackingScalingPolicyConfiguration: aas.PolicyTargetTrackingScalingPolicyConfigurationArgs{
-			CustomizedMetricSpecification: nil,
-			DisableScaleIn:                nil,
-			PredefinedMetricSpecification: aas.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
-				PredefinedMetricType: plm.String("ECSServiceAverageCPUUtilization"),
-			},
-			ScaleInCooldown:  plm.IntPtr(30),
-			ScaleOutCooldown: plm.IntPtr(1),
-			TargetValue:      plm.Float64(c.AppScaleCpuPercent),
-		},
-	}, plm.Parent(&dfa),
-		plm.DependsOn([]plm.Resource{svc}))
-	if err != nil {
+	scaling := fargateApiScaling{
+		ctx:        ctx,
+		children:   children,
+		target:     target,
+		resourceId: autoscaleResourceId,
+	}
+	if err := scaling.newPolicies(c, productEnv, lb, tg); err != nil {
+		return nil, err
+	}
+	if err := scaling.newScheduledActions(c.AppScaleSchedules, c.AppScaleTimeZone, c.AppScaleDaylightSaving, time.Now()); err != nil {
 		return nil, err
 	}
 
-	if c.LBCertificateArn != "" {
-		zone, err := route53.LookupZone(ctx, &route53.LookupZoneArgs{
+	if c.LBDomain != "" && c.LBSubDomain != "" {
+		zoneArgs := &route53.LookupZoneArgs{
 			Name: &c.LBDomain,
-		}, plm.Parent(&dfa))
+		}
+		if internalLB(c) {
+			private := true
+			zoneArgs.PrivateZone = &private
+			zoneArgs.VpcId = &c.VPCId
+		}
+		zone, err := route53.LookupZone(ctx, zoneArgs, plm.Parent(&dfa))
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = route53.NewRecord(ctx, "record", &route53.RecordArgs{
+		_, err = route53.NewRecord(ctx, children.name("record"), &route53.RecordArgs{
 			Name:   plm.String(fmt.Sprintf("%v.%v", c.LBSubDomain, c.LBDomain)),
 			Type:   plm.String("A"),
 			ZoneId: plm.String(zone.ZoneId),
@@ -307,36 +487,45 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 					EvaluateTargetHealth: plm.Bool(true),
 				},
 			},
-		}, plm.Parent(&dfa))
+		}, children.options("aws:route53/record:Record", "record", children.alias("record"))...)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	ecrRepo, err := ecr.NewRepository(ctx, "ecr", &ecr.RepositoryArgs{
+	ecrRepo, err := ecr.NewRepository(ctx, children.name("ecr"), &ecr.RepositoryArgs{
 		Name: plm.String(productEnv),
-	}, plm.Parent(&dfa))
+	}, children.options("aws:ecr/repository:Repository", "ecr", children.alias("ecr"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = ecr.NewLifecyclePolicy(ctx, "ecrLifecycle", &ecr.LifecyclePolicyArgs{
+	_, err = ecr.NewLifecyclePolicy(ctx, children.name("ecrLifecycle"), &ecr.LifecyclePolicyArgs{
 		Policy:     plm.String(ECR_LIFECYCLE_POLICY),
 		Repository: ecrRepo.Name,
-	}, plm.Parent(&dfa))
+	}, children.options("aws:ecr/lifecyclePolicy:LifecyclePolicy", "ecrLifecycle", children.alias("ecrLifecycle"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+	bucket, err := s3.NewBucket(ctx, children.name("bucket"), &s3.BucketArgs{
 		Bucket: plm.String(fmt.Sprintf("%v-cicd", productEnv)),
 		Acl:    plm.String("private"),
-	}, plm.Parent(&dfa))
+	}, children.options("aws:s3/bucket:Bucket", "bucket", children.alias("bucket"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = build.NewProject(ctx, "codebuild", &build.ProjectArgs{
+	buildSpec := BuildSpecTemplate(registry, region, productEnv)
+	if bg != nil {
+		taskDefinition, err := codeDeployTaskDefinition(c, productEnv, region, secretArn, logRouterImage, healthCheck, sidecars)
+		if err != nil {
+			return nil, err
+		}
+		buildSpec = BlueGreenBuildSpecTemplate(registry, region, productEnv, taskDefinition, AppSpecTemplate("app", c.AppPort))
+	}
+
+	_, err = build.NewProject(ctx, children.name("codebuild"), &build.ProjectArgs{
 		Artifacts: build.ProjectArtifactsArgs{
 			Type: plm.String("CODEPIPELINE"),
 		},
@@ -350,10 +539,10 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 		Name:        plm.String(productEnv),
 		ServiceRole: plm.String(c.CICDBuildRole),
 		Source: build.ProjectSourceArgs{
-			Buildspec: plm.String(BuildSpecTemplate(productEnv)),
+			Buildspec: plm.String(buildSpec),
 			Type:      plm.String("CODEPIPELINE"),
 		},
-	}, plm.Parent(&dfa))
+	}, children.options("aws:codebuild/project:Project", "codebuild", children.alias("codebuild"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -361,12 +550,12 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 	stages := pipeline.PipelineStageArray{
 		NewGithubSourceStage(c.GitRepo, c.GitBranch, c.CICDGitPolling),
 		NewCodebuildStage(productEnv, c.CICDRequireApproval),
-		fargateApiCD(c.Product, productEnv),
+		fargateApiCD(c.Product, productEnv, bg != nil),
 	}
 
 	stages = NewNotifyStageAction(stages, c.GitRepo, c.CICDRequireNotification)
 
-	if _, err := pipeline.NewPipeline(ctx, "codepipeline", &pipeline.PipelineArgs{
+	if _, err := pipeline.NewPipeline(ctx, children.name("codepipeline"), &pipeline.PipelineArgs{
 		Name:    plm.String(productEnv),
 		RoleArn: plm.String(c.CICDPipelineRole),
 		ArtifactStore: pipeline.PipelineArtifactStoreArgs{
@@ -374,9 +563,10 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 			Type:     plm.String("S3"),
 		},
 		Stages: stages,
-	}, plm.Parent(&dfa),
-		plm.DependsOn([]plm.Resource{ecrRepo}),
-		plm.IgnoreChanges([]string{"oAuthToken"})); err != nil {
+	}, children.options("aws:codepipeline/pipeline:Pipeline", "codepipeline",
+		children.alias("codepipeline"),
+		plm.DependsOn(append(pipelineDependencies, ecrRepo)),
+		plm.IgnoreChanges([]string{"oAuthToken"}))...); err != nil {
 		return nil, err
 	}
 
@@ -391,6 +581,23 @@ func NewFargateApi(ctx *plm.Context, c FargateApiArgs,
 	return &dfa, nil
 }
 
+func NewHttpsRedirectListener(lb *alb.LoadBalancer) *alb.ListenerArgs {
+	return &alb.ListenerArgs{
+		LoadBalancerArn: lb.Arn,
+		Port:            plm.Int(80),
+		DefaultActions: alb.ListenerDefaultActionArray{
+			alb.ListenerDefaultActionArgs{
+				Type: plm.String("redirect"),
+				Redirect: alb.ListenerDefaultActionRedirectArgs{
+					Port:       plm.StringPtr("443"),
+					Protocol:   plm.StringPtr("HTTPS"),
+					StatusCode: plm.String("HTTP_301"),
+				},
+			},
+		},
+	}
+}
+
 func NewSimpleForwardingHttpsListener(
 	lb *alb.LoadBalancer,
 	tg *alb.TargetGroup,
@@ -415,15 +622,192 @@ func NewSimpleForwardingHttpsListener(
 	return &https
 }
 
+// fargateApiCD deploys with the CodeDeploy application and deployment group
+// named after the service in blue/green mode.
 func fargateApiCD(
 	ecsCluster string,
 	ecsService string,
+	blueGreen bool,
 ) pipeline.PipelineStageArgs {
 	actions := pipeline.PipelineStageActionArray{}
-	actions = AddECSDeployAction(actions, ecsCluster, ecsService)
+	if blueGreen {
+		actions = AddCodeDeployToECSAction(actions, ecsService, ecsService)
+	} else {
+		actions = AddECSDeployAction(actions, ecsCluster, ecsService)
+	}
 
 	return pipeline.PipelineStageArgs{
 		Name:    plm.String("Deploy"),
 		Actions: actions,
 	}
 }
+
+func desiredCount(c FargateApiArgs) int {
+	if c.ECSDesiredCount == 0 {
+		return 1
+	}
+	return c.ECSDesiredCount
+}
+
+func checkDeploymentArgs(c FargateApiArgs) error {
+	min, max := 100, 200
+	if c.ECSDeploymentMinimumHealthyPercent != nil {
+		min = *c.ECSDeploymentMinimumHealthyPercent
+	}
+	if c.ECSDeploymentMaximumPercent != nil {
+		max = *c.ECSDeploymentMaximumPercent
+	}
+
+	switch {
+	case c.ECSDesiredCount < 0:
+		return fmt.Errorf("ecs desired count %v is negative", c.ECSDesiredCount)
+	case min < 0 || min > 100:
+		return fmt.Errorf("ecs deployment minimum healthy percent %v is not within 0 and 100", min)
+	case max < 100:
+		return fmt.Errorf("ecs deployment maximum percent %v is below 100", max)
+	case min == 100 && max == 100:
+		return fmt.Errorf("ecs deployments cannot replace tasks with both percents at 100")
+	case c.ECSHealthCheckGracePeriod < 0:
+		return fmt.Errorf("ecs health check grace period %v is negative", c.ECSHealthCheckGracePeriod)
+	}
+	return nil
+}
+
+func intPtr(i *int) plm.IntPtrInput {
+	if i == nil {
+		return nil
+	}
+	return plm.IntPtr(*i)
+}
+
+// internalLB reports whether the API is served by an internal load
+// balancer, its own or a shared one.
+func internalLB(c FargateApiArgs) bool {
+	if c.SharedAlb != nil {
+		return c.SharedAlb.Internal
+	}
+	return c.LBInternal
+}
+
+func assignPublicIp(c FargateApiArgs) bool {
+	if c.ECSTaskAssignPublicIp != nil {
+		return *c.ECSTaskAssignPublicIp
+	}
+	return !internalLB(c)
+}
+
+func scheduledIgnored(c FargateApiArgs) []string {
+	if len(c.AppScaleSchedules) == 0 {
+		return nil
+	}
+	return []string{"minCapacity", "maxCapacity"}
+}
+
+func deploymentController(c FargateApiArgs) string {
+	if c.BlueGreen != nil {
+		return "CODE_DEPLOY"
+	}
+	return "ECS"
+}
+
+// serviceIgnored lists the props of the service owned by something else: the
+// desired count by the autoscaling, and the task definition by CodeDeploy or,
+// when asked to, by the pipeline.
+func serviceIgnored(c FargateApiArgs) []string {
+	ignored := append([]string{"desiredCount"}, blueGreenIgnored(c, "taskDefinition", "loadBalancers")...)
+	if c.ECSIgnoreTaskDefinitionChanges && c.BlueGreen == nil {
+		ignored = append(ignored, "taskDefinition")
+	}
+	return ignored
+}
+
+// blueGreenIgnored returns props in blue/green mode, where CodeDeploy owns
+// them, and nothing otherwise.
+func blueGreenIgnored(c FargateApiArgs, props ...string) []string {
+	if c.BlueGreen == nil {
+		return nil
+	}
+	return props
+}
+
+// codeDeployTaskDefinition renders the task definition of the app as
+// CodeDeployToECS expects it, with the image left to fill in.
+func codeDeployTaskDefinition(
+	c FargateApiArgs,
+	productEnv string,
+	region string,
+	secretArn string,
+	logRouterImage string,
+	healthCheck HealthCheck,
+	sidecars []ContainerDefinition,
+) (string, error) {
+	containerDefinitions, err := ContainerDefinitionTemplate(
+		CODEDEPLOY_IMAGE_PLACEHOLDER,
+		c.AppPort,
+		productEnv,
+		region,
+		c.AppEnvs,
+		&secretArn,
+		c.AppSecrets,
+		c.AppLogRouterEnvs,
+		c.AppEnableLogRouter,
+		logRouterImage,
+		&healthCheck,
+		sidecars...,
+	)
+	if err != nil {
+		return "", err
+	}
+	return TaskDefinitionTemplate(productEnv, c.AppCpu, c.AppMemory, c.ECSTaskRole, c.ECSExecutionRole, containerDefinitions)
+}
+
+// appHealthCheck returns the health check of the app container, completed
+// with the defaults derived from the health check path and app port.
+func appHealthCheck(c FargateApiArgs) (HealthCheck, error) {
+	var h HealthCheck
+	if c.AppHealthCheck != nil {
+		h = *c.AppHealthCheck
+	}
+	h, err := h.withDefaults(HttpHealthCheck(c.AppPort, healthCheckPath(c)))
+	if err != nil {
+		return h, fmt.Errorf("app health check: %w", err)
+	}
+	return h, nil
+}
+
+func healthCheckPath(c FargateApiArgs) string {
+	if c.AppHealthCheckPath == "" {
+		return "/"
+	}
+	return c.AppHealthCheckPath
+}
+
+// unhealthyThreshold maps the retries of a container health check to the
+// unhealthy threshold of a target group, which is at least 2.
+func unhealthyThreshold(retries int) int {
+	if retries < 2 {
+		return 2
+	}
+	return retries
+}
+
+// awsAccountRegion returns the account and region set in the args, looking
+// up those of the active provider when they are not.
+func awsAccountRegion(ctx *plm.Context, c FargateApiArgs, opts ...plm.InvokeOption) (string, string, error) {
+	account, region := c.AWSAccountId, c.AWSRegion
+	if account == "" {
+		identity, err := aws.GetCallerIdentity(ctx, opts...)
+		if err != nil {
+			return "", "", err
+		}
+		account = identity.AccountId
+	}
+	if region == "" {
+		r, err := aws.GetRegion(ctx, &aws.GetRegionArgs{}, opts...)
+		if err != nil {
+			return "", "", err
+		}
+		region = r.Name
+	}
+	return account, region, nil
+}
@@ -0,0 +1,222 @@
+package dulumi
+
+import (
+	"fmt"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/codedeploy"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/ecs"
+	alb "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/lb"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/sallgoood/dulumi/utils"
+)
+
+// BlueGreenArgs deploys a FargateApi with CodeDeploy, which starts the new
+// tasks in a second target group and shifts the traffic to them.
+type BlueGreenArgs struct {
+	// ServiceRole is the ARN of the role CodeDeploy deploys with.
+	ServiceRole string `json:"service-role"`
+	// TestListenerPort serves the new tasks before they get the traffic.
+	// Defaults to 8443.
+	TestListenerPort int             `json:"test-listener-port"`
+	Traffic          TrafficShifting `json:"traffic"`
+	// TerminationWaitMinutes keeps the old tasks running after a deployment,
+	// to roll back to. Defaults to 5.
+	TerminationWaitMinutes int `json:"termination-wait-minutes"`
+	// RollbackAlarms are the CloudWatch alarms that roll a deployment back.
+	// Failed deployments are always rolled back.
+	RollbackAlarms []string `json:"rollback-alarms"`
+}
+
+// Traffic shifting types of BlueGreenArgs.
+const (
+	TRAFFIC_ALL_AT_ONCE = "all-at-once"
+	TRAFFIC_CANARY      = "canary"
+	TRAFFIC_LINEAR      = "linear"
+)
+
+// TrafficShifting moves the traffic all at once, in two steps (canary) or in
+// equal steps (linear) of Percentage every IntervalMinutes.
+type TrafficShifting struct {
+	Type            string `json:"type"`
+	Percentage      int    `json:"percentage"`
+	IntervalMinutes int    `json:"interval-minutes"`
+}
+
+// maxTargetGroupNameLength is the longest name AWS accepts for a target group.
+const maxTargetGroupNameLength = 32
+
+// greenTargetGroupName names the green target group after the blue one.
+func greenTargetGroupName(blue string) string {
+	return fmt.Sprintf("%v-green", blue)
+}
+
+// withDefaults checks the arguments of a service whose blue target group is
+// named blue, and fills in the defaults.
+func (b BlueGreenArgs) withDefaults(blue string) (BlueGreenArgs, error) {
+	if b.ServiceRole == "" {
+		return b, fmt.Errorf("blue/green: a CodeDeploy service role is required")
+	}
+	if green := greenTargetGroupName(blue); len(green) > maxTargetGroupNameLength {
+		return b, fmt.Errorf("blue/green: green target group name %q is longer than %v characters, shorten the product or env",
+			green, maxTargetGroupNameLength)
+	}
+	if b.TestListenerPort == 0 {
+		b.TestListenerPort = 8443
+	}
+	if b.TerminationWaitMinutes == 0 {
+		b.TerminationWaitMinutes = 5
+	}
+
+	switch b.Traffic.Type {
+	case "":
+		b.Traffic.Type = TRAFFIC_ALL_AT_ONCE
+	case TRAFFIC_ALL_AT_ONCE:
+	case TRAFFIC_CANARY, TRAFFIC_LINEAR:
+		if b.Traffic.Percentage < 1 || b.Traffic.Percentage > 99 {
+			return b, fmt.Errorf("blue/green: traffic percentage %v is not within 1 and 99", b.Traffic.Percentage)
+		}
+		if b.Traffic.IntervalMinutes < 1 {
+			return b, fmt.Errorf("blue/green: traffic interval must be at least a minute")
+		}
+	default:
+		return b, fmt.Errorf("blue/green: unknown traffic shifting %q", b.Traffic.Type)
+	}
+	return b, nil
+}
+
+// blueGreenDeployment holds the resources a blue/green FargateApi deploys
+// with, besides its service and production listener.
+type blueGreenDeployment struct {
+	args         BlueGreenArgs
+	green        *alb.TargetGroup
+	testListener *alb.Listener
+	group        *codedeploy.DeploymentGroup
+}
+
+// newBlueGreenListener declares the green target group and the test
+// listener. The production listener serves blue until the first deployment.
+func newBlueGreenListener(
+	ctx *plm.Context,
+	children childNames,
+	args BlueGreenArgs,
+	lb *alb.LoadBalancer,
+	blue *alb.TargetGroup,
+	green *alb.TargetGroupArgs,
+	certificateArn string,
+) (*blueGreenDeployment, error) {
+	tg, err := alb.NewTargetGroup(ctx, children.name("targetGroupGreen"), green,
+		children.options("aws:lb/targetGroup:TargetGroup", "targetGroupGreen")...)
+	if err != nil {
+		return nil, err
+	}
+
+	testArgs := NewSimpleForwardingHttpsListener(lb, blue, certificateArn)
+	testArgs.Port = plm.Int(args.TestListenerPort)
+	test, err := alb.NewListener(ctx, children.name("testListener"), testArgs,
+		children.options("aws:lb/listener:Listener", "testListener",
+			plm.IgnoreChanges([]string{"defaultActions"}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blueGreenDeployment{args: args, green: tg, testListener: test}, nil
+}
+
+// newDeploymentGroup declares the CodeDeploy application and deployment
+// group of the service, both named after it.
+func (d *blueGreenDeployment) newDeploymentGroup(
+	ctx *plm.Context,
+	children childNames,
+	cluster string,
+	service string,
+	svc *ecs.Service,
+	prod *alb.Listener,
+	blue *alb.TargetGroup,
+) error {
+	app, err := codedeploy.NewApplication(ctx, children.name("codedeployApp"), &codedeploy.ApplicationArgs{
+		Name:            plm.String(service),
+		ComputePlatform: plm.String("ECS"),
+	}, children.options("aws:codedeploy/application:Application", "codedeployApp")...)
+	if err != nil {
+		return err
+	}
+
+	configName := plm.StringPtr("CodeDeployDefault.ECSAllAtOnce").ToStringPtrOutput()
+	if t := d.args.Traffic; t.Type != TRAFFIC_ALL_AT_ONCE {
+		routing := codedeploy.DeploymentConfigTrafficRoutingConfigArgs{}
+		step := codedeploy.DeploymentConfigTrafficRoutingConfigTimeBasedCanaryArgs{
+			Interval:   plm.IntPtr(t.IntervalMinutes),
+			Percentage: plm.IntPtr(t.Percentage),
+		}
+		if t.Type == TRAFFIC_CANARY {
+			routing.Type = plm.StringPtr("TimeBasedCanary")
+			routing.TimeBasedCanary = step
+		} else {
+			routing.Type = plm.StringPtr("TimeBasedLinear")
+			routing.TimeBasedLinear = codedeploy.DeploymentConfigTrafficRoutingConfigTimeBasedLinearArgs(step)
+		}
+
+		config, err := codedeploy.NewDeploymentConfig(ctx, children.name("codedeployConfig"), &codedeploy.DeploymentConfigArgs{
+			DeploymentConfigName: plm.String(fmt.Sprintf("%v-%v-%v-%v", service, t.Type, t.Percentage, t.IntervalMinutes)),
+			ComputePlatform:      plm.String("ECS"),
+			TrafficRoutingConfig: routing,
+		}, children.options("aws:codedeploy/deploymentConfig:DeploymentConfig", "codedeployConfig")...)
+		if err != nil {
+			return err
+		}
+		configName = config.DeploymentConfigName.ToStringPtrOutput()
+	}
+
+	var alarms codedeploy.DeploymentGroupAlarmConfigurationPtrInput
+	events := plm.StringArray{plm.String("DEPLOYMENT_FAILURE")}
+	if len(d.args.RollbackAlarms) > 0 {
+		alarms = codedeploy.DeploymentGroupAlarmConfigurationArgs{
+			Alarms:  utils.ToPulumiStringArray(d.args.RollbackAlarms),
+			Enabled: plm.BoolPtr(true),
+		}
+		events = append(events, plm.String("DEPLOYMENT_STOP_ON_ALARM"))
+	}
+
+	d.group, err = codedeploy.NewDeploymentGroup(ctx, children.name("codedeployGroup"), &codedeploy.DeploymentGroupArgs{
+		AppName:              app.Name,
+		DeploymentGroupName:  plm.String(service),
+		DeploymentConfigName: configName,
+		ServiceRoleArn:       plm.String(d.args.ServiceRole),
+		AlarmConfiguration:   alarms,
+		AutoRollbackConfiguration: codedeploy.DeploymentGroupAutoRollbackConfigurationArgs{
+			Enabled: plm.BoolPtr(true),
+			Events:  events,
+		},
+		DeploymentStyle: codedeploy.DeploymentGroupDeploymentStyleArgs{
+			DeploymentOption: plm.StringPtr("WITH_TRAFFIC_CONTROL"),
+			DeploymentType:   plm.StringPtr("BLUE_GREEN"),
+		},
+		BlueGreenDeploymentConfig: codedeploy.DeploymentGroupBlueGreenDeploymentConfigArgs{
+			DeploymentReadyOption: codedeploy.DeploymentGroupBlueGreenDeploymentConfigDeploymentReadyOptionArgs{
+				ActionOnTimeout: plm.StringPtr("CONTINUE_DEPLOYMENT"),
+			},
+			TerminateBlueInstancesOnDeploymentSuccess: codedeploy.DeploymentGroupBlueGreenDeploymentConfigTerminateBlueInstancesOnDeploymentSuccessArgs{
+				Action:                       plm.StringPtr("TERMINATE"),
+				TerminationWaitTimeInMinutes: plm.IntPtr(d.args.TerminationWaitMinutes),
+			},
+		},
+		EcsService: codedeploy.DeploymentGroupEcsServiceArgs{
+			ClusterName: plm.String(cluster),
+			ServiceName: svc.Name,
+		},
+		LoadBalancerInfo: codedeploy.DeploymentGroupLoadBalancerInfoArgs{
+			TargetGroupPairInfo: codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoArgs{
+				ProdTrafficRoute: codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoProdTrafficRouteArgs{
+					ListenerArns: plm.StringArray{prod.Arn},
+				},
+				TestTrafficRoute: codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoTestTrafficRouteArgs{
+					ListenerArns: plm.StringArray{d.testListener.Arn},
+				},
+				TargetGroups: codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoTargetGroupArray{
+					codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoTargetGroupArgs{Name: blue.Name},
+					codedeploy.DeploymentGroupLoadBalancerInfoTargetGroupPairInfoTargetGroupArgs{Name: d.green.Name},
+				},
+			},
+		},
+	}, children.options("aws:codedeploy/deploymentGroup:DeploymentGroup", "codedeployGroup")...)
+	return err
+}
@@ -0,0 +1,209 @@
+package dulumi
+
+import (
+	"fmt"
+	aas "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/appautoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/cloudwatch"
+	alb "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/lb"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"strconv"
+)
+
+// StepScaling changes the task count by steps when a CloudWatch metric, such
+// as the depth of a SQS queue, crosses a threshold.
+type StepScaling struct {
+	// Name tells the policy and its alarm apart from the others.
+	Name       string            `json:"name"`
+	Namespace  string            `json:"namespace"`
+	MetricName string            `json:"metric-name"`
+	Dimensions map[string]string `json:"dimensions"`
+	// Statistic defaults to Average over Period seconds, 60 by default, in
+	// EvaluationPeriods periods, 1 by default.
+	Statistic         string `json:"statistic"`
+	Period            int    `json:"period"`
+	EvaluationPeriods int    `json:"evaluation-periods"`
+	// ComparisonOperator compares the metric with Threshold, e.g.
+	// GreaterThanOrEqualToThreshold.
+	ComparisonOperator string  `json:"comparison-operator"`
+	Threshold          float64 `json:"threshold"`
+	// AdjustmentType defaults to ChangeInCapacity and Cooldown to 60 seconds.
+	AdjustmentType string        `json:"adjustment-type"`
+	Cooldown       int           `json:"cooldown"`
+	Steps          []ScalingStep `json:"steps"`
+}
+
+// ScalingStep adjusts the task count while the metric is within the bounds,
+// relative to the threshold. A nil bound is unbounded.
+type ScalingStep struct {
+	LowerBound *float64 `json:"lower-bound"`
+	UpperBound *float64 `json:"upper-bound"`
+	Adjustment int      `json:"adjustment"`
+}
+
+func (s StepScaling) withDefaults() (StepScaling, error) {
+	if s.Name == "" || s.MetricName == "" || s.Namespace == "" {
+		return s, fmt.Errorf("step scaling %q: name, namespace and metric name are required", s.Name)
+	}
+	if s.ComparisonOperator == "" || len(s.Steps) == 0 {
+		return s, fmt.Errorf("step scaling %q: a comparison operator and steps are required", s.Name)
+	}
+	if s.Statistic == "" {
+		s.Statistic = "Average"
+	}
+	if s.Period == 0 {
+		s.Period = 60
+	}
+	if s.EvaluationPeriods == 0 {
+		s.EvaluationPeriods = 1
+	}
+	if s.AdjustmentType == "" {
+		s.AdjustmentType = "ChangeInCapacity"
+	}
+	if s.Cooldown == 0 {
+		s.Cooldown = 60
+	}
+	return s, nil
+}
+
+// fargateApiScaling declares the scaling policies of a FargateApi on its
+// scalable target.
+type fargateApiScaling struct {
+	ctx        *plm.Context
+	children   childNames
+	target     *aas.Target
+	resourceId plm.StringInput
+}
+
+func (s fargateApiScaling) newPolicies(c FargateApiArgs, productEnv string, lb *alb.LoadBalancer, tg *alb.TargetGroup) error {
+	scaleIn, scaleOut := 30, 1
+	if c.AppScaleInCooldown != nil {
+		scaleIn = *c.AppScaleInCooldown
+	}
+	if c.AppScaleOutCooldown != nil {
+		scaleOut = *c.AppScaleOutCooldown
+	}
+
+	tracking := func(child string, name string, target float64, metric aas.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs) error {
+		_, err := aas.NewPolicy(s.ctx, s.children.name(child), &aas.PolicyArgs{
+			Name:              plm.String(name),
+			PolicyType:        plm.String("TargetTrackingScaling"),
+			ResourceId:        s.resourceId,
+			ScalableDimension: plm.String("ecs:service:DesiredCount"),
+			ServiceNamespace:  plm.String("ecs"),
+			TargetTrackingScalingPolicyConfiguration: aas.PolicyTargetTrackingScalingPolicyConfigurationArgs{
+				PredefinedMetricSpecification: metric,
+				ScaleInCooldown:               plm.IntPtr(scaleIn),
+				ScaleOutCooldown:              plm.IntPtr(scaleOut),
+				TargetValue:                   plm.Float64(target),
+			},
+		}, s.children.options("aws:appautoscaling/policy:Policy", child,
+			s.children.alias(child),
+			plm.DependsOn([]plm.Resource{s.target}))...)
+		return err
+	}
+
+	if c.AppScaleCpuPercent > 0 {
+		if err := tracking("autoscalePolicy", "scale-inout", c.AppScaleCpuPercent,
+			aas.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
+				PredefinedMetricType: plm.String("ECSServiceAverageCPUUtilization"),
+			}); err != nil {
+			return err
+		}
+	}
+	if c.AppScaleMemoryPercent > 0 {
+		if err := tracking("autoscaleMemoryPolicy", "scale-memory", c.AppScaleMemoryPercent,
+			aas.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
+				PredefinedMetricType: plm.String("ECSServiceAverageMemoryUtilization"),
+			}); err != nil {
+			return err
+		}
+	}
+	if c.AppScaleRequestsPerTarget > 0 {
+		if err := tracking("autoscaleRequestsPolicy", "scale-requests", c.AppScaleRequestsPerTarget,
+			aas.PolicyTargetTrackingScalingPolicyConfigurationPredefinedMetricSpecificationArgs{
+				PredefinedMetricType: plm.String("ALBRequestCountPerTarget"),
+				ResourceLabel:        plm.Sprintf("%v/%v", lb.ArnSuffix, tg.ArnSuffix),
+			}); err != nil {
+			return err
+		}
+	}
+
+	names := map[string]bool{}
+	for _, step := range c.AppScaleSteps {
+		step, err := step.withDefaults()
+		if err != nil {
+			return err
+		}
+		if names[step.Name] {
+			return fmt.Errorf("step scaling %q: duplicate name", step.Name)
+		}
+		names[step.Name] = true
+
+		if err := s.newStepPolicy(step, productEnv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newStepPolicy declares a step scaling policy and the alarm that triggers
+// it.
+func (s fargateApiScaling) newStepPolicy(step StepScaling, productEnv string) error {
+	bound := func(b *float64) plm.StringPtrInput {
+		if b == nil {
+			return nil
+		}
+		return plm.StringPtr(strconv.FormatFloat(*b, 'f', -1, 64))
+	}
+
+	// Step scaling aggregates only by Minimum, Maximum or Average.
+	aggregation := "Average"
+	if step.Statistic == "Minimum" || step.Statistic == "Maximum" {
+		aggregation = step.Statistic
+	}
+
+	var adjustments aas.PolicyStepScalingPolicyConfigurationStepAdjustmentArray
+	for _, a := range step.Steps {
+		adjustments = append(adjustments, aas.PolicyStepScalingPolicyConfigurationStepAdjustmentArgs{
+			MetricIntervalLowerBound: bound(a.LowerBound),
+			MetricIntervalUpperBound: bound(a.UpperBound),
+			ScalingAdjustment:        plm.Int(a.Adjustment),
+		})
+	}
+
+	policy, err := aas.NewPolicy(s.ctx, s.children.name("autoscaleStepPolicy-"+step.Name), &aas.PolicyArgs{
+		Name:              plm.String("scale-" + step.Name),
+		PolicyType:        plm.String("StepScaling"),
+		ResourceId:        s.resourceId,
+		ScalableDimension: plm.String("ecs:service:DesiredCount"),
+		ServiceNamespace:  plm.String("ecs"),
+		StepScalingPolicyConfiguration: aas.PolicyStepScalingPolicyConfigurationArgs{
+			AdjustmentType:        plm.StringPtr(step.AdjustmentType),
+			Cooldown:              plm.IntPtr(step.Cooldown),
+			MetricAggregationType: plm.StringPtr(aggregation),
+			StepAdjustments:       adjustments,
+		},
+	}, s.children.options("aws:appautoscaling/policy:Policy", "autoscaleStepPolicy-"+step.Name,
+		plm.DependsOn([]plm.Resource{s.target}))...)
+	if err != nil {
+		return err
+	}
+
+	dimensions := plm.StringMap{}
+	for k, v := range step.Dimensions {
+		dimensions[k] = plm.String(v)
+	}
+	_, err = cloudwatch.NewMetricAlarm(s.ctx, s.children.name("autoscaleStepAlarm-"+step.Name), &cloudwatch.MetricAlarmArgs{
+		Name:               plm.String(fmt.Sprintf("%v-scale-%v", productEnv, step.Name)),
+		Namespace:          plm.String(step.Namespace),
+		MetricName:         plm.String(step.MetricName),
+		Dimensions:         dimensions,
+		Statistic:          plm.String(step.Statistic),
+		Period:             plm.Int(step.Period),
+		EvaluationPeriods:  plm.Int(step.EvaluationPeriods),
+		ComparisonOperator: plm.String(step.ComparisonOperator),
+		Threshold:          plm.Float64(step.Threshold),
+		AlarmActions:       plm.Array{policy.Arn},
+	}, s.children.options("aws:cloudwatch/metricAlarm:MetricAlarm", "autoscaleStepAlarm-"+step.Name)...)
+	return err
+}
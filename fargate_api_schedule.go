@@ -0,0 +1,185 @@
+package dulumi
+
+import (
+	"fmt"
+	aas "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/appautoscaling"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScheduledScaling sets the task count bounds of a FargateApi on a schedule,
+// e.g. both to 0 in the evening and back in the morning. Schedule is a
+// cron(), at() or rate() expression of Application Auto Scaling.
+type ScheduledScaling struct {
+	Name        string `json:"name"`
+	Schedule    string `json:"schedule"`
+	MinCapacity *int   `json:"min-capacity"`
+	MaxCapacity *int   `json:"max-capacity"`
+}
+
+// newScheduledActions declares the scheduled actions of a FargateApi. Their
+// cron() and at() schedules are read in the time zone timeZone, see
+// scheduleInUTC for daylightSaving.
+func (s fargateApiScaling) newScheduledActions(schedules []ScheduledScaling, timeZone string, daylightSaving bool, now time.Time) error {
+	loc, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return fmt.Errorf("scheduled scaling: %w", err)
+	}
+
+	names := map[string]bool{}
+	for _, sc := range schedules {
+		if sc.Name == "" || sc.Schedule == "" {
+			return fmt.Errorf("scheduled scaling %q: name and schedule are required", sc.Name)
+		}
+		if sc.MinCapacity == nil && sc.MaxCapacity == nil {
+			return fmt.Errorf("scheduled scaling %q: set a min or max capacity", sc.Name)
+		}
+		if names[sc.Name] {
+			return fmt.Errorf("scheduled scaling %q: duplicate name", sc.Name)
+		}
+		names[sc.Name] = true
+
+		schedule, err := scheduleInUTC(sc.Schedule, loc, daylightSaving, now)
+		if err != nil {
+			return fmt.Errorf("scheduled scaling %q: %w", sc.Name, err)
+		}
+
+		_, err = aas.NewScheduledAction(s.ctx, s.children.name("autoscaleSchedule-"+sc.Name), &aas.ScheduledActionArgs{
+			Name:              plm.String(sc.Name),
+			ResourceId:        s.resourceId,
+			ScalableDimension: plm.String("ecs:service:DesiredCount"),
+			ServiceNamespace:  plm.String("ecs"),
+			Schedule:          plm.String(schedule),
+			ScalableTargetAction: aas.ScheduledActionScalableTargetActionArgs{
+				MinCapacity: intPtr(sc.MinCapacity),
+				MaxCapacity: intPtr(sc.MaxCapacity),
+			},
+		}, s.children.options("aws:appautoscaling/scheduledAction:ScheduledAction", "autoscaleSchedule-"+sc.Name,
+			plm.DependsOn([]plm.Resource{s.target}))...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scheduleInUTC converts a schedule of loc to UTC, which is the only time
+// zone Application Auto Scaling knows of. cron() schedules take the offset
+// of loc at now, so they are rejected in zones with daylight saving time
+// unless daylightSaving accepts that they shift by an hour when it starts or
+// ends, until the next update.
+func scheduleInUTC(schedule string, loc *time.Location, daylightSaving bool, now time.Time) (string, error) {
+	switch {
+	case strings.HasPrefix(schedule, "at(") && strings.HasSuffix(schedule, ")"):
+		t, err := time.ParseInLocation("2006-01-02T15:04:05", schedule[3:len(schedule)-1], loc)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("at(%v)", t.UTC().Format("2006-01-02T15:04:05")), nil
+
+	case strings.HasPrefix(schedule, "cron(") && strings.HasSuffix(schedule, ")"):
+		if !daylightSaving && !fixedOffset(loc, now.Year()) {
+			return "", fmt.Errorf("%v has daylight saving time, which shifts cron() schedules converted to UTC", loc)
+		}
+		_, offset := now.In(loc).Zone()
+		if offset == 0 {
+			return schedule, nil
+		}
+		return cronInUTC(schedule[5:len(schedule)-1], offset/60)
+
+	default:
+		return schedule, nil
+	}
+}
+
+// fixedOffset tells whether loc has the same offset in January and July of
+// year, that is no daylight saving time.
+func fixedOffset(loc *time.Location, year int) bool {
+	_, january := time.Date(year, time.January, 1, 0, 0, 0, 0, loc).Zone()
+	_, july := time.Date(year, time.July, 1, 0, 0, 0, 0, loc).Zone()
+	return january == july
+}
+
+var weekDays = []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}
+
+// cronInUTC moves the minutes and hours fields of a cron expression back by
+// offset minutes, and its day of week along when that crosses midnight. Only
+// single minutes and hours can be moved.
+func cronInUTC(cron string, offset int) (string, error) {
+	fields := strings.Fields(cron)
+	if len(fields) != 6 {
+		return "", fmt.Errorf("cron(%v) does not have 6 fields", cron)
+	}
+	minute, errM := strconv.Atoi(fields[0])
+	hour, errH := strconv.Atoi(fields[1])
+	if errM != nil || errH != nil {
+		return "", fmt.Errorf("cron(%v) needs a single minute and hour to change time zone", cron)
+	}
+
+	total := hour*60 + minute - offset
+	days := 0
+	for total < 0 {
+		total += 24 * 60
+		days--
+	}
+	for total >= 24*60 {
+		total -= 24 * 60
+		days++
+	}
+	fields[0], fields[1] = strconv.Itoa(total%60), strconv.Itoa(total/60)
+
+	if days != 0 {
+		if fields[2] != "*" && fields[2] != "?" {
+			return "", fmt.Errorf("cron(%v) moves to another day in UTC, which only works on days of week", cron)
+		}
+		dow, err := shiftWeekDays(fields[4], days)
+		if err != nil {
+			return "", fmt.Errorf("cron(%v): %w", cron, err)
+		}
+		fields[4] = dow
+	}
+	return fmt.Sprintf("cron(%v)", strings.Join(fields, " ")), nil
+}
+
+// shiftWeekDays moves a day of week field by days, expanding its ranges.
+func shiftWeekDays(field string, days int) (string, error) {
+	if field == "*" || field == "?" {
+		return field, nil
+	}
+
+	day := func(s string) (int, error) {
+		for i, d := range weekDays {
+			if strings.EqualFold(s, d) {
+				return i, nil
+			}
+		}
+		if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= 7 {
+			return n - 1, nil
+		}
+		return 0, fmt.Errorf("unsupported day of week %q", s)
+	}
+
+	var res []string
+	for _, part := range strings.Split(field, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		from, err := day(bounds[0])
+		if err != nil {
+			return "", err
+		}
+		to := from
+		if len(bounds) == 2 {
+			if to, err = day(bounds[1]); err != nil {
+				return "", err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			res = append(res, weekDays[((d+days)%7+7)%7])
+			if d == to {
+				break
+			}
+		}
+	}
+	return strings.Join(res, ","), nil
+}
@@ -0,0 +1,284 @@
+package dulumi
+
+import (
+	"encoding/json"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/sallgoood/dulumi/utils"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func testFargateApiArgs(product string) FargateApiArgs {
+	return FargateApiArgs{
+		Product:     product,
+		Env:         "dev",
+		AppPort:     8080,
+		AppCpu:      "256",
+		AppMemory:   "512",
+		AppScaleMin: 1,
+		AppScaleMax: 2,
+		GitRepo:     "org/" + product,
+		GitBranch:   "main",
+	}
+}
+
+func TestFargateApiIgnoreWithStackAutoTags(t *testing.T) {
+	m := &mocks{inputs: map[string]resource.PropertyMap{}}
+	ignored := map[string][]string{}
+	err := utils.RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, utils.RegisterAutoTags(ctx, plm.StringMap{"Owner": plm.String("platform")}))
+		// The auto tags change every resource, so the options a resource keeps
+		// are the ones it was declared with, as this later transformation sees.
+		assert.NoError(t, ctx.RegisterStackTransformation(func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+			ignored[args.Name] = ignoredProps(args.Opts)
+			return nil
+		}))
+
+		_, err := NewFargateApi(ctx, "api", testFargateApiArgs("api"),
+			Ignore{Types: []string{"aws:ecs/*"}, Props: []string{"networkConfiguration"}})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", m))
+	assert.NoError(t, err)
+
+	assert.Contains(t, ignored["api-ecsService"], "networkConfiguration")
+	assert.Contains(t, ignored["api-ecsService"], "desiredCount")
+	assert.Contains(t, ignored["api-ecsTaskDefinition"], "networkConfiguration")
+	assert.NotContains(t, ignored["api-logGroup"], "networkConfiguration")
+
+	tags := m.inputs["api-ecsService"]["tags"].ObjectValue()
+	assert.Equal(t, "platform", tags["Owner"].StringValue())
+	assert.Equal(t, "api", tags["Service"].StringValue())
+}
+
+func TestFargateApiInstances(t *testing.T) {
+	m := &mocks{inputs: map[string]resource.PropertyMap{}}
+	declared := map[string][]plm.Alias{}
+	err := utils.RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, ctx.RegisterStackTransformation(func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+			declared[args.Name] = aliases(args.Opts)
+			return nil
+		}))
+
+		_, err := NewFargateApi(ctx, FARGATE_API_LEGACY_NAME, testFargateApiArgs("users"), Ignore{})
+		assert.NoError(t, err)
+		_, err = NewFargateApi(ctx, "orders", testFargateApiArgs("orders"), Ignore{})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", m))
+	assert.NoError(t, err)
+
+	for _, child := range []string{"alb", "targetGroup", "ecsTaskDefinition", "ecsService", "autoscaleTarget", "codepipeline"} {
+		legacy := FARGATE_API_LEGACY_NAME + "-" + child
+		assert.Contains(t, m.inputs, legacy)
+		assert.Equal(t, []plm.Alias{{Name: plm.String(child)}}, declared[legacy])
+
+		assert.Contains(t, m.inputs, "orders-"+child)
+		assert.Empty(t, declared["orders-"+child])
+	}
+	assert.Equal(t, "users-dev", m.inputs[FARGATE_API_LEGACY_NAME+"-ecsService"]["name"].StringValue())
+	assert.Equal(t, "orders-dev", m.inputs["orders-ecsService"]["name"].StringValue())
+}
+
+func TestFargateApiRegistry(t *testing.T) {
+	explicit := testFargateApiArgs("api")
+	explicit.AWSAccountId = "210987654321"
+	explicit.AWSRegion = "us-east-1"
+
+	for _, tc := range []struct {
+		args     FargateApiArgs
+		registry string
+		region   string
+	}{
+		{testFargateApiArgs("api"), "123456789012.dkr.ecr.ap-northeast-2.amazonaws.com", "ap-northeast-2"},
+		{explicit, "210987654321.dkr.ecr.us-east-1.amazonaws.com", "us-east-1"},
+	} {
+		m := &mocks{inputs: map[string]resource.PropertyMap{}}
+		err := utils.RunErr(func(ctx *plm.Context) error {
+			_, err := NewFargateApi(ctx, "api", tc.args, Ignore{})
+			assert.NoError(t, err)
+			return nil
+		}, plm.WithMocks("project", "stack", m))
+		assert.NoError(t, err)
+
+		var defs []ContainerDefinition
+		assert.NoError(t, json.Unmarshal([]byte(m.inputs["api-ecsTaskDefinition"]["containerDefinitions"].StringValue()), &defs))
+		assert.Equal(t, tc.registry+"/api-dev:latest", defs[0].Image)
+		assert.Equal(t, tc.region, defs[0].LogConfiguration.Options["awslogs-region"])
+
+		spec := m.inputs["api-codebuild"]["source"].ObjectValue()["buildspec"].StringValue()
+		assert.Contains(t, spec, "      - ECR="+tc.registry+"\n")
+		assert.Contains(t, spec, "aws ecr get-login-password --region "+tc.region+" | docker login")
+	}
+}
+
+// ignoredProps replays opts to collect the props they ignore.
+func ignoredProps(opts []plm.ResourceOption) []string {
+	var props []string
+	for _, v := range utils.OptionValues(opts, "IgnoreChanges") {
+		props = append(props, v.([]string)...)
+	}
+	return props
+}
+
+// aliases replays opts to collect the aliases they declare by name, leaving
+// out the type aliases the AWS SDK adds itself.
+func aliases(opts []plm.ResourceOption) []plm.Alias {
+	var res []plm.Alias
+	for _, v := range utils.OptionValues(opts, "Aliases") {
+		for _, a := range v.([]plm.Alias) {
+			if a.Name != nil {
+				res = append(res, a)
+			}
+		}
+	}
+	return res
+}
+
+func TestFargateApiBlueGreenRequestsPerTarget(t *testing.T) {
+	args := testFargateApiArgs("api")
+	args.BlueGreen = &BlueGreenArgs{}
+	args.AppScaleRequestsPerTarget = 100
+
+	err := utils.RunErr(func(ctx *plm.Context) error {
+		_, err := NewFargateApi(ctx, "api", args, Ignore{})
+		assert.EqualError(t, err, "blue/green deployments cannot scale on the requests per target")
+		return nil
+	}, plm.WithMocks("project", "stack", &mocks{inputs: map[string]resource.PropertyMap{}}))
+	assert.NoError(t, err)
+}
+
+func TestAppHealthCheck(t *testing.T) {
+	h, err := appHealthCheck(FargateApiArgs{AppPort: 8080, AppHealthCheckPath: "/health"})
+	assert.NoError(t, err)
+	assert.Equal(t, HealthCheck{
+		Command:  []string{"CMD-SHELL", "curl -fs http://localhost:8080/health || exit 1"},
+		Interval: 30,
+		Timeout:  5,
+		Retries:  3,
+	}, h)
+
+	h, err = appHealthCheck(FargateApiArgs{AppPort: 80, AppHealthCheck: &HealthCheck{Retries: 1, StartPeriod: 60}})
+	assert.NoError(t, err)
+	assert.Equal(t, "curl -fs http://localhost:80/ || exit 1", h.Command[1])
+	assert.Equal(t, 60, h.StartPeriod)
+	assert.Equal(t, 2, unhealthyThreshold(h.Retries))
+
+	_, err = appHealthCheck(FargateApiArgs{AppPort: 80, AppHealthCheck: &HealthCheck{Interval: 10, Timeout: 10}})
+	assert.Error(t, err)
+}
+
+func TestCheckDeploymentArgs(t *testing.T) {
+	percent := func(i int) *int { return &i }
+
+	assert.NoError(t, checkDeploymentArgs(FargateApiArgs{}))
+	assert.NoError(t, checkDeploymentArgs(FargateApiArgs{
+		ECSDeploymentMinimumHealthyPercent: percent(50),
+		ECSDeploymentMaximumPercent:        percent(100),
+	}))
+	assert.Error(t, checkDeploymentArgs(FargateApiArgs{ECSDeploymentMaximumPercent: percent(100)}))
+	assert.Error(t, checkDeploymentArgs(FargateApiArgs{ECSDeploymentMinimumHealthyPercent: percent(150)}))
+	assert.Equal(t, 1, desiredCount(FargateApiArgs{}))
+	assert.Equal(t, 3, desiredCount(FargateApiArgs{ECSDesiredCount: 3}))
+}
+
+func TestServiceIgnored(t *testing.T) {
+	assert.Equal(t, []string{"desiredCount"}, serviceIgnored(FargateApiArgs{}))
+	assert.Equal(t, []string{"desiredCount", "taskDefinition"},
+		serviceIgnored(FargateApiArgs{ECSIgnoreTaskDefinitionChanges: true}))
+	assert.Equal(t, []string{"desiredCount", "taskDefinition", "loadBalancers"},
+		serviceIgnored(FargateApiArgs{ECSIgnoreTaskDefinitionChanges: true, BlueGreen: &BlueGreenArgs{}}))
+}
+
+func TestCapacityProviderStrategies(t *testing.T) {
+	strategies, err := serviceCapacityProviderStrategies(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, strategies)
+
+	strategies, err = serviceCapacityProviderStrategies([]CapacityProviderStrategy{
+		{CapacityProvider: FARGATE, Base: 1, Weight: 1},
+		{CapacityProvider: FARGATE_SPOT, Weight: 4},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, strategies)
+
+	assert.Error(t, checkCapacityProviderStrategies([]CapacityProviderStrategy{
+		{CapacityProvider: FARGATE, Base: 1, Weight: 1},
+		{CapacityProvider: FARGATE_SPOT, Base: 1, Weight: 4},
+	}))
+	assert.Error(t, checkCapacityProviderStrategies([]CapacityProviderStrategy{{CapacityProvider: FARGATE_SPOT}}))
+	assert.Error(t, checkCapacityProviderStrategies([]CapacityProviderStrategy{{Weight: 1}}))
+}
+
+func TestStepScalingDefaults(t *testing.T) {
+	_, err := StepScaling{Name: "queue"}.withDefaults()
+	assert.Error(t, err)
+
+	s, err := StepScaling{
+		Name:               "queue",
+		Namespace:          "AWS/SQS",
+		MetricName:         "ApproximateNumberOfMessagesVisible",
+		ComparisonOperator: "GreaterThanOrEqualToThreshold",
+		Threshold:          100,
+		Steps:              []ScalingStep{{Adjustment: 1}},
+	}.withDefaults()
+	assert.NoError(t, err)
+	assert.Equal(t, "Average", s.Statistic)
+	assert.Equal(t, 60, s.Period)
+	assert.Equal(t, 1, s.EvaluationPeriods)
+	assert.Equal(t, "ChangeInCapacity", s.AdjustmentType)
+	assert.Equal(t, 60, s.Cooldown)
+}
+
+func TestScheduleInUTC(t *testing.T) {
+	seoul, err := time.LoadLocation("Asia/Seoul")
+	assert.NoError(t, err)
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	winter := time.Date(2020, 1, 15, 0, 0, 0, 0, time.UTC)
+	summer := time.Date(2020, 7, 15, 0, 0, 0, 0, time.UTC)
+
+	for _, c := range []struct {
+		schedule string
+		loc      *time.Location
+		now      time.Time
+		expected string
+	}{
+		{"cron(0 20 ? * MON-FRI *)", seoul, winter, "cron(0 11 ? * MON-FRI *)"},
+		{"cron(0 8 ? * MON-FRI *)", seoul, winter, "cron(0 23 ? * SUN,MON,TUE,WED,THU *)"},
+		{"cron(30 8 ? * 2,7 *)", seoul, winter, "cron(30 23 ? * SUN,FRI *)"},
+		{"cron(0 8 * * ? *)", seoul, winter, "cron(0 23 * * ? *)"},
+		{"cron(0 8 ? * SAT-MON *)", berlin, winter, "cron(0 7 ? * SAT-MON *)"},
+		{"cron(0 8 ? * SAT-MON *)", berlin, summer, "cron(0 6 ? * SAT-MON *)"},
+		{"cron(0 0 ? * SAT-MON *)", berlin, summer, "cron(0 22 ? * FRI,SAT,SUN *)"},
+		{"at(2020-12-24T18:00:00)", seoul, winter, "at(2020-12-24T09:00:00)"},
+		{"rate(1 hour)", seoul, winter, "rate(1 hour)"},
+		{"cron(0 8 ? * MON-FRI *)", time.UTC, winter, "cron(0 8 ? * MON-FRI *)"},
+	} {
+		schedule, err := scheduleInUTC(c.schedule, c.loc, c.loc == berlin, c.now)
+		assert.NoError(t, err, c.schedule)
+		assert.Equal(t, c.expected, schedule, c.schedule)
+	}
+
+	_, err = scheduleInUTC("cron(0 8 1 * ? *)", seoul, false, winter)
+	assert.Error(t, err)
+	_, err = scheduleInUTC("cron(0 */2 ? * MON-FRI *)", seoul, false, winter)
+	assert.Error(t, err)
+	_, err = scheduleInUTC("cron(0 8 ? * MON-FRI *)", berlin, false, winter)
+	assert.EqualError(t, err, "Europe/Berlin has daylight saving time, which shifts cron() schedules converted to UTC")
+	schedule, err := scheduleInUTC("at(2020-07-24T18:00:00)", berlin, false, winter)
+	assert.NoError(t, err)
+	assert.Equal(t, "at(2020-07-24T16:00:00)", schedule)
+}
+
+func TestAssignPublicIp(t *testing.T) {
+	public := true
+
+	assert.True(t, assignPublicIp(FargateApiArgs{}))
+	assert.False(t, assignPublicIp(FargateApiArgs{LBInternal: true}))
+	assert.True(t, assignPublicIp(FargateApiArgs{LBInternal: true, ECSTaskAssignPublicIp: &public}))
+	assert.False(t, assignPublicIp(FargateApiArgs{SharedAlb: &SharedAlb{Internal: true}}))
+	assert.True(t, internalLB(FargateApiArgs{SharedAlb: &SharedAlb{Internal: true}}))
+}
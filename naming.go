@@ -0,0 +1,97 @@
+package dulumi
+
+import (
+	"fmt"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/sallgoood/dulumi/utils"
+)
+
+// Names the components were registered with before a stack could hold more
+// than one instance of them. Instances with these names keep aliases to their
+// old child names, so existing stacks do not replace their resources.
+const (
+	FARGATE_API_LEGACY_NAME   = "drama-fargate-api"
+	S3_STATIC_WEB_LEGACY_NAME = "drama-s3-static-web"
+)
+
+// Types the components are registered with.
+const (
+	fargateApiType  = "drama:server:fargate-api"
+	s3StaticWebType = "drama:web:s3-static"
+	sharedAlbType   = "drama:server:shared-alb"
+)
+
+// componentTagging loads the auto tag config of the stack and returns the
+// transformation tagging the children of a component of product in env.
+func componentTagging(ctx *plm.Context, env, product string) (*utils.AutoTagConfig, plm.ResourceTransformation, error) {
+	tagConfig, err := utils.LoadAutoTagConfig(ctx, AUTO_TAG_CONFIG_NAMESPACE)
+	if err != nil {
+		return nil, nil, err
+	}
+	tagging, err := tagConfig.TagTransformation(ctx, plm.StringMap{
+		"Role":        plm.String("infra"),
+		"Environment": plm.String(env),
+		"Service":     plm.String(product),
+		"Team":        plm.String("dev"),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return tagConfig, tagging, nil
+}
+
+// childNames derives unique names for the children of a component instance,
+// and the options they are declared with.
+type childNames struct {
+	instance string
+	legacy   bool
+
+	ctx        *plm.Context
+	parent     plm.Resource
+	parentType string
+	config     *utils.AutoTagConfig
+}
+
+// newChildNames names the children of parent, a component of type parentType
+// registered as instance, and gives them the options config declares for them.
+func newChildNames(
+	ctx *plm.Context,
+	parent plm.Resource,
+	parentType string,
+	config *utils.AutoTagConfig,
+	instance string,
+	legacyInstance string,
+) childNames {
+	return childNames{
+		instance:   instance,
+		legacy:     instance == legacyInstance,
+		ctx:        ctx,
+		parent:     parent,
+		parentType: parentType,
+		config:     config,
+	}
+}
+
+func (n childNames) name(child string) string {
+	return fmt.Sprintf("%v-%v", n.instance, child)
+}
+
+// alias points a legacy instance's child at its old name. It is a no-op for
+// any other instance.
+func (n childNames) alias(child string) plm.ResourceOption {
+	if !n.legacy {
+		return plm.Aliases(nil)
+	}
+	return plm.Aliases([]plm.Alias{{Name: plm.String(child)}})
+}
+
+// options returns the options of child, a resource of type t: its parent, the
+// options the stack config gives it, then opts. See
+// utils.AutoTagConfig.ResourceOptions for why they are not left to a
+// component transformation.
+func (n childNames) options(t string, child string, opts ...plm.ResourceOption) []plm.ResourceOption {
+	res := append([]plm.ResourceOption{plm.Parent(n.parent)},
+		n.config.ResourceOptions(n.ctx, t, n.name(child), n.parentType)...)
+	return append(res, opts...)
+}
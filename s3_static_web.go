@@ -37,33 +37,32 @@ type S3StaticWebArgs struct {
 	CICDRequireNotification bool                `json:"cicd-require-notification"`
 }
 
-func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
+// NewS3StaticWeb declares a static website whose children are named after
+// name. Stacks created before instances were named pass
+// S3_STATIC_WEB_LEGACY_NAME.
+func NewS3StaticWeb(ctx *plm.Context, name string, c *S3StaticWebArgs,
 	opts ...plm.ResourceOption) (*S3StaticWeb, error) {
-	utils.RegisterAutoTags(ctx, plm.StringMap{
-		"Role":        plm.String("infra"),
-		"Environment": plm.String(c.Env),
-		"Service":     plm.String(c.Product),
-		"Team":        plm.String("dev"),
-	})
-
-	utils.IgnoreChanges(ctx,
-		true,
-		nil,
-		[]string{
-			"oAuthToken",
-		})
+	tagConfig, tagging, err := componentTagging(ctx, c.Env, c.Product)
+	if err != nil {
+		return nil, err
+	}
+	tagConfig.IgnoreChanges = append(tagConfig.IgnoreChanges,
+		utils.IgnoreRule{Global: true, Props: []string{"oAuthToken"}})
 
 	host := fmt.Sprintf("%v.%v", c.SubDomain, c.Domain)
 	envProduct := fmt.Sprintf("%v-%v", c.Env, c.Product)
 	productEnv := fmt.Sprintf("%v-%v", c.Product, c.Env)
 
 	var dsw S3StaticWeb
-	err := ctx.RegisterComponentResource("drama:web:s3-static", "drama-s3-static-web", &dsw, opts...)
+	err = ctx.RegisterComponentResource(s3StaticWebType, name, &dsw,
+		append(opts, plm.Transformations([]plm.ResourceTransformation{tagging}))...)
 	if err != nil {
 		return nil, err
 	}
 
-	bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+	children := newChildNames(ctx, &dsw, s3StaticWebType, tagConfig, name, S3_STATIC_WEB_LEGACY_NAME)
+
+	bucket, err := s3.NewBucket(ctx, children.name("bucket"), &s3.BucketArgs{
 		Acl:    plm.String("private"),
 		Bucket: plm.String(host),
 		Versioning: s3.BucketVersioningArgs{
@@ -72,7 +71,7 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 		Website: s3.BucketWebsiteArgs{
 			RedirectAllRequestsTo: plm.String(fmt.Sprintf("https://%v", plm.String(host))),
 		},
-	}, plm.Parent(&dsw))
+	}, children.options("aws:s3/bucket:Bucket", "bucket", children.alias("bucket"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -84,14 +83,15 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 		return nil, err
 	}
 
-	originAccessIdentity, err := cloudfront.NewOriginAccessIdentity(ctx, "originAccessIdentity", &cloudfront.OriginAccessIdentityArgs{
+	originAccessIdentity, err := cloudfront.NewOriginAccessIdentity(ctx, children.name("originAccessIdentity"), &cloudfront.OriginAccessIdentityArgs{
 		Comment: plm.String(host),
-	}, plm.Parent(&dsw))
+	}, children.options("aws:cloudfront/originAccessIdentity:OriginAccessIdentity", "originAccessIdentity",
+		children.alias("originAccessIdentity"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	distribution, err := cloudfront.NewDistribution(ctx, "distribution", &cloudfront.DistributionArgs{
+	distribution, err := cloudfront.NewDistribution(ctx, children.name("distribution"), &cloudfront.DistributionArgs{
 		Aliases: plm.StringArray{
 			plm.String(host),
 		},
@@ -141,12 +141,12 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 			SslSupportMethod:       plm.String("sni-only"),
 			MinimumProtocolVersion: plm.String("TLSv1"),
 		},
-	}, plm.Parent(&dsw))
+	}, children.options("aws:cloudfront/distribution:Distribution", "distribution", children.alias("distribution"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = route53.NewRecord(ctx, "record", &route53.RecordArgs{
+	_, err = route53.NewRecord(ctx, children.name("record"), &route53.RecordArgs{
 		Name:   plm.String(host),
 		Type:   plm.String("A"),
 		ZoneId: plm.String(zone.ZoneId),
@@ -157,12 +157,12 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 				EvaluateTargetHealth: plm.Bool(true),
 			},
 		},
-	}, plm.Parent(&dsw))
+	}, children.options("aws:route53/record:Record", "record", children.alias("record"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := s3.NewBucketPolicy(ctx, "bucketPolicy", &s3.BucketPolicyArgs{
+	if _, err := s3.NewBucketPolicy(ctx, children.name("bucketPolicy"), &s3.BucketPolicyArgs{
 		Bucket: bucket.Bucket,
 		Policy: plm.Any(map[string]interface{}{
 			"Version": "2012-10-17",
@@ -181,14 +181,14 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 				},
 			},
 		}),
-	}, plm.Parent(&dsw)); err != nil {
+	}, children.options("aws:s3/bucketPolicy:BucketPolicy", "bucketPolicy", children.alias("bucketPolicy"))...); err != nil {
 		return nil, err
 	}
 
-	_, err = s3.NewBucket(ctx, "cicd-bucket", &s3.BucketArgs{
+	_, err = s3.NewBucket(ctx, children.name("cicd-bucket"), &s3.BucketArgs{
 		Bucket: plm.String(fmt.Sprintf("%v-cicd", envProduct)),
 		Acl:    plm.String("private"),
-	}, plm.Parent(&dsw))
+	}, children.options("aws:s3/bucket:Bucket", "cicd-bucket", children.alias("cicd-bucket"))...)
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +208,7 @@ func NewS3StaticWeb(ctx *plm.Context, c *S3StaticWebArgs,
 
 	buildEnvs = AppendBuildEnvs(c.CICDBuildEnvs, buildEnvs)
 
-	_, err = build.NewProject(ctx, "codebuild", &build.ProjectArgs{
+	_, err = build.NewProject(ctx, children.name("codebuild"), &build.ProjectArgs{
 		Artifacts: build.ProjectArtifactsArgs{
 			Type: plm.String("CODEPIPELINE"),
 		},
@@ -249,12 +249,12 @@ phases:
 `),
 			Type: plm.String("CODEPIPELINE"),
 		},
-	}, plm.Parent(&dsw))
+	}, children.options("aws:codebuild/project:Project", "codebuild", children.alias("codebuild"))...)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := pipeline.NewPipeline(ctx, "codepipeline", &pipeline.PipelineArgs{
+	if _, err := pipeline.NewPipeline(ctx, children.name("codepipeline"), &pipeline.PipelineArgs{
 		Name:    plm.String(productEnv),
 		RoleArn: plm.String(c.CICDPipelineRole),
 		ArtifactStore: pipeline.PipelineArtifactStoreArgs{
@@ -265,8 +265,9 @@ phases:
 			NewGithubSourceStage(c.GitRepo, c.GitBranch, c.CICDGitPolling),
 			NewCodebuildStage(productEnv, c.CICDRequireApproval),
 		},
-	}, plm.Parent(&dsw),
-		plm.IgnoreChanges([]string{"oAuthToken"})); err != nil {
+	}, children.options("aws:codepipeline/pipeline:Pipeline", "codepipeline",
+		children.alias("codepipeline"),
+		plm.IgnoreChanges([]string{"oAuthToken"}))...); err != nil {
 		return nil, err
 	}
 
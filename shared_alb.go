@@ -0,0 +1,153 @@
+package dulumi
+
+import (
+	"fmt"
+	alb "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/lb"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/sallgoood/dulumi/utils"
+)
+
+// SharedAlb is a load balancer that several FargateApi instances attach to
+// with listener rules, instead of each declaring its own.
+type SharedAlb struct {
+	plm.ResourceState
+
+	Dns plm.StringOutput `pulumi:"dnsName"`
+
+	LoadBalancer  *alb.LoadBalancer
+	HttpsListener *alb.Listener
+	Internal      bool
+}
+
+type SharedAlbArgs struct {
+	Product string `json:"product"`
+	Env     string `json:"env"`
+
+	LBSubnetIPs        []string `json:"lb-subnet-ids"`
+	LBSecurityGroupIds []string `json:"lb-security-group-ids"`
+	LBCertificateArn   string   `json:"lb-certificate-arn"`
+	// LBInternal keeps the load balancer off the internet.
+	LBInternal bool `json:"lb-internal"`
+}
+
+// ListenerRule routes the requests of a shared load balancer that match all
+// of its set fields. Priorities must be unique on the load balancer, lower
+// ones are evaluated first.
+type ListenerRule struct {
+	Hosts    []string `json:"hosts"`
+	Paths    []string `json:"paths"`
+	Priority int      `json:"priority"`
+}
+
+// NewSharedAlb declares a load balancer that redirects HTTP to HTTPS and
+// answers 404 to the requests no listener rule matches.
+func NewSharedAlb(ctx *plm.Context, name string, c SharedAlbArgs, opts ...plm.ResourceOption) (*SharedAlb, error) {
+	tagConfig, tagging, err := componentTagging(ctx, c.Env, c.Product)
+	if err != nil {
+		return nil, err
+	}
+
+	var sa SharedAlb
+	err = ctx.RegisterComponentResource(sharedAlbType, name, &sa,
+		append(opts, plm.Transformations([]plm.ResourceTransformation{tagging}))...)
+	if err != nil {
+		return nil, err
+	}
+
+	children := newChildNames(ctx, &sa, sharedAlbType, tagConfig, name, "")
+
+	lb, err := alb.NewLoadBalancer(ctx, children.name("alb"), &alb.LoadBalancerArgs{
+		Name:           plm.String(fmt.Sprintf("%v-%v", c.Product, c.Env)),
+		Internal:       plm.BoolPtr(c.LBInternal),
+		Subnets:        utils.ToPulumiStringArray(c.LBSubnetIPs),
+		SecurityGroups: utils.ToPulumiStringArray(c.LBSecurityGroupIds),
+	}, children.options("aws:lb/loadBalancer:LoadBalancer", "alb")...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = alb.NewListener(ctx, children.name("httpListener"), NewHttpsRedirectListener(lb),
+		children.options("aws:lb/listener:Listener", "httpListener")...)
+	if err != nil {
+		return nil, err
+	}
+
+	https := alb.ListenerArgs{
+		LoadBalancerArn: lb.Arn,
+		Protocol:        plm.String("HTTPS"),
+		Port:            plm.Int(443),
+		DefaultActions: alb.ListenerDefaultActionArray{
+			alb.ListenerDefaultActionArgs{
+				Type: plm.String("fixed-response"),
+				FixedResponse: alb.ListenerDefaultActionFixedResponseArgs{
+					ContentType: plm.String("text/plain"),
+					StatusCode:  plm.StringPtr("404"),
+				},
+			},
+		},
+	}
+	if c.LBCertificateArn != "" {
+		https.CertificateArn = plm.StringPtr(c.LBCertificateArn)
+	}
+	sa.HttpsListener, err = alb.NewListener(ctx, children.name("httpsListener"), &https,
+		children.options("aws:lb/listener:Listener", "httpsListener")...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ctx.RegisterResourceOutputs(&sa, plm.Map{
+		"dns": lb.DnsName,
+	}); err != nil {
+		return nil, err
+	}
+
+	sa.LoadBalancer = lb
+	sa.Internal = c.LBInternal
+	sa.Dns = lb.DnsName
+
+	return &sa, nil
+}
+
+// newListenerRule forwards the requests matching rule to tg.
+func (sa *SharedAlb) newListenerRule(
+	ctx *plm.Context,
+	name string,
+	rule ListenerRule,
+	tg *alb.TargetGroup,
+	opts ...plm.ResourceOption,
+) (*alb.ListenerRule, error) {
+	if len(rule.Hosts) == 0 && len(rule.Paths) == 0 {
+		return nil, fmt.Errorf("listener rule: set hosts or paths")
+	}
+	if rule.Priority < 1 || rule.Priority > 50000 {
+		return nil, fmt.Errorf("listener rule: priority %v is not within 1 and 50000", rule.Priority)
+	}
+
+	var conditions alb.ListenerRuleConditionArray
+	if len(rule.Hosts) > 0 {
+		conditions = append(conditions, alb.ListenerRuleConditionArgs{
+			HostHeader: alb.ListenerRuleConditionHostHeaderArgs{
+				Values: utils.ToPulumiStringArray(rule.Hosts),
+			},
+		})
+	}
+	if len(rule.Paths) > 0 {
+		conditions = append(conditions, alb.ListenerRuleConditionArgs{
+			PathPattern: alb.ListenerRuleConditionPathPatternArgs{
+				Values: utils.ToPulumiStringArray(rule.Paths),
+			},
+		})
+	}
+
+	return alb.NewListenerRule(ctx, name, &alb.ListenerRuleArgs{
+		ListenerArn: sa.HttpsListener.Arn,
+		Priority:    plm.IntPtr(rule.Priority),
+		Conditions:  conditions,
+		Actions: alb.ListenerRuleActionArray{
+			alb.ListenerRuleActionArgs{
+				Type:           plm.String("forward"),
+				TargetGroupArn: tg.Arn,
+			},
+		},
+	}, opts...)
+}
@@ -0,0 +1,100 @@
+package dulumi
+
+import (
+	alb "github.com/pulumi/pulumi-aws/sdk/v3/go/aws/lb"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/sallgoood/dulumi/utils"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"testing"
+)
+
+// mocks records the inputs of the resources it creates by name.
+type mocks struct {
+	sync.Mutex
+	inputs map[string]resource.PropertyMap
+}
+
+func (m *mocks) NewResource(typeToken, name string, inputs resource.PropertyMap, provider, id string) (string, resource.PropertyMap, error) {
+	m.Lock()
+	defer m.Unlock()
+	m.inputs[name] = inputs
+	return name + "_id", inputs, nil
+}
+
+// Call answers the account and region lookups with a fixed account in
+// ap-northeast-2.
+func (m *mocks) Call(token string, args resource.PropertyMap, provider string) (resource.PropertyMap, error) {
+	switch token {
+	case "aws:index/getCallerIdentity:getCallerIdentity":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"accountId": "123456789012"}), nil
+	case "aws:index/getRegion:getRegion":
+		return resource.NewPropertyMapFromMap(map[string]interface{}{"name": "ap-northeast-2"}), nil
+	}
+	return args, nil
+}
+
+func TestSharedAlb(t *testing.T) {
+	m := &mocks{inputs: map[string]resource.PropertyMap{}}
+	err := utils.RunErr(func(ctx *plm.Context) error {
+		sa, err := NewSharedAlb(ctx, "shared", SharedAlbArgs{Product: "api", Env: "dev"})
+		assert.NoError(t, err)
+
+		tg, err := alb.NewTargetGroup(ctx, "tg", &alb.TargetGroupArgs{})
+		assert.NoError(t, err)
+
+		_, err = sa.newListenerRule(ctx, "rule", ListenerRule{
+			Hosts:    []string{"users.example.com"},
+			Paths:    []string{"/v1/*"},
+			Priority: 10,
+		}, tg)
+		assert.NoError(t, err)
+
+		_, err = sa.newListenerRule(ctx, "no-condition", ListenerRule{Priority: 11}, tg)
+		assert.Error(t, err)
+		_, err = sa.newListenerRule(ctx, "no-priority", ListenerRule{Paths: []string{"/"}}, tg)
+		assert.Error(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", m))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "api-dev", m.inputs["shared-alb"]["name"].StringValue())
+	assert.Equal(t, "fixed-response",
+		m.inputs["shared-httpsListener"]["defaultActions"].ArrayValue()[0].ObjectValue()["type"].StringValue())
+
+	rule := m.inputs["rule"]
+	assert.Equal(t, 10.0, rule["priority"].NumberValue())
+	conditions := rule["conditions"].ArrayValue()
+	assert.Equal(t, "users.example.com",
+		conditions[0].ObjectValue()["hostHeader"].ObjectValue()["values"].ArrayValue()[0].StringValue())
+	assert.Equal(t, "/v1/*",
+		conditions[1].ObjectValue()["pathPattern"].ObjectValue()["values"].ArrayValue()[0].StringValue())
+	assert.NotContains(t, m.inputs, "no-condition")
+}
+
+func TestFargateApiOnSharedAlb(t *testing.T) {
+	m := &mocks{inputs: map[string]resource.PropertyMap{}}
+	err := utils.RunErr(func(ctx *plm.Context) error {
+		sa, err := NewSharedAlb(ctx, "shared", SharedAlbArgs{Product: "platform", Env: "dev"})
+		assert.NoError(t, err)
+
+		args := testFargateApiArgs("users")
+		args.SharedAlb = sa
+		args.LBRule = ListenerRule{Hosts: []string{"users.example.com"}, Priority: 10}
+		args.LBDomain = "example.com"
+		args.LBSubDomain = "users"
+		_, err = NewFargateApi(ctx, "users", args, Ignore{})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", m))
+	assert.NoError(t, err)
+
+	assert.NotContains(t, m.inputs, "users-alb")
+	assert.NotContains(t, m.inputs, "users-httpsListener")
+	assert.Equal(t, 10.0, m.inputs["users-listenerRule"]["priority"].NumberValue())
+
+	record := m.inputs["users-record"]
+	assert.Equal(t, "users.example.com", record["name"].StringValue())
+	assert.Equal(t, "A", record["type"].StringValue())
+}
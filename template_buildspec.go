@@ -1,8 +1,33 @@
 package dulumi
 
-import "fmt"
+import (
+	"encoding/base64"
+	"fmt"
+)
 
-func BuildSpecTemplate(ecrName string) string {
+func BuildSpecTemplate(ecrRegistry string, ecrRegion string, ecrName string) string {
+	return buildSpec(ecrRegistry, ecrRegion, ecrName, "", "")
+}
+
+// BlueGreenBuildSpecTemplate also writes the imageDetail.json, taskdef.json
+// and appspec.yaml artifacts of the CodeDeployToECS action.
+func BlueGreenBuildSpecTemplate(ecrRegistry string, ecrRegion string, ecrName string, taskDefinition string, appSpec string) string {
+	write := func(file string, content string) string {
+		return fmt.Sprintf("      - echo %v | base64 -d > %v\n",
+			base64.StdEncoding.EncodeToString([]byte(content)), file)
+	}
+
+	commands := `      - echo Writing the CodeDeploy artifacts...
+      - printf '{"ImageURI":"%s"}' $IMAGE_URI > imageDetail.json
+` + write("taskdef.json", taskDefinition) + write("appspec.yaml", appSpec)
+	files := `    - imageDetail.json
+    - taskdef.json
+    - appspec.yaml
+`
+	return buildSpec(ecrRegistry, ecrRegion, ecrName, commands, files)
+}
+
+func buildSpec(ecrRegistry string, ecrRegion string, ecrName string, postBuildCommands string, artifactFiles string) string {
 	return fmt.Sprintf(`
 version: 0.2
 
@@ -10,8 +35,8 @@ phases:
   pre_build:
     commands:
       - aws --version
-      - ECR=784015586554.dkr.ecr.ap-northeast-1.amazonaws.com
-      - $(aws ecr get-login --no-include-email)
+      - ECR=%v
+      - aws ecr get-login-password --region %v | docker login --username AWS --password-stdin $ECR
       - IMAGE_REPO_NAME=%v
       - IMAGE_TAG="$(echo $CODEBUILD_RESOLVED_SOURCE_VERSION)"
       - printf $IMAGE_TAG
@@ -32,8 +57,8 @@ phases:
       - echo Writing imagedefinitions.json...
       - printf '[{"name":"app","imageUri":"%%s"}]' $IMAGE_URI > imagedefinitions.json
       - cat imagedefinitions.json
-artifacts:
+%vartifacts:
   files:
     - imagedefinitions.json
-`, ecrName)
+%v`, ecrRegistry, ecrRegion, ecrName, postBuildCommands, artifactFiles)
 }
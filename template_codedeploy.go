@@ -0,0 +1,63 @@
+package dulumi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// CODEDEPLOY_IMAGE_PLACEHOLDER is replaced by CodeDeployToECS with the image
+// the build pushed.
+const CODEDEPLOY_IMAGE_PLACEHOLDER = "<IMAGE1_NAME>"
+
+// TaskDefinitionTemplate renders the taskdef.json CodeDeployToECS registers
+// a task definition revision from. The app image of containerDefinitions
+// should be CODEDEPLOY_IMAGE_PLACEHOLDER.
+func TaskDefinitionTemplate(
+	family string,
+	cpu string,
+	memory string,
+	taskRoleArn string,
+	executionRoleArn string,
+	containerDefinitions string,
+) (string, error) {
+	td := struct {
+		Family                  string          `json:"family"`
+		Cpu                     string          `json:"cpu"`
+		Memory                  string          `json:"memory"`
+		NetworkMode             string          `json:"networkMode"`
+		RequiresCompatibilities []string        `json:"requiresCompatibilities"`
+		TaskRoleArn             string          `json:"taskRoleArn"`
+		ExecutionRoleArn        string          `json:"executionRoleArn"`
+		ContainerDefinitions    json.RawMessage `json:"containerDefinitions"`
+	}{
+		family,
+		cpu,
+		memory,
+		"awsvpc",
+		[]string{"FARGATE"},
+		taskRoleArn,
+		executionRoleArn,
+		json.RawMessage(containerDefinitions),
+	}
+
+	b, err := json.MarshalIndent(td, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("task definition template: %w", err)
+	}
+	return string(b), nil
+}
+
+// AppSpecTemplate renders the appspec.yaml that routes the load balancer to
+// a container of the new task definition.
+func AppSpecTemplate(containerName string, containerPort int) string {
+	return fmt.Sprintf(`version: 0.0
+Resources:
+  - TargetService:
+      Type: AWS::ECS::Service
+      Properties:
+        TaskDefinition: <TASK_DEFINITION>
+        LoadBalancerInfo:
+          ContainerName: "%v"
+          ContainerPort: %v
+`, containerName, containerPort)
+}
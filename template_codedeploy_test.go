@@ -0,0 +1,60 @@
+package dulumi
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"testing"
+)
+
+func TestBlueGreenBuildSpecTemplate(t *testing.T) {
+	defs, err := ContainerDefinitionTemplate(CODEDEPLOY_IMAGE_PLACEHOLDER, 8080, "app", "ap-northeast-1",
+		map[string]string{"QUOTE": `'"`}, nil, nil, nil, false, "", nil)
+	assert.NoError(t, err)
+	taskDef, err := TaskDefinitionTemplate("app-prod", "256", "512", "task-role", "execution-role", defs)
+	assert.NoError(t, err)
+	appSpec := AppSpecTemplate("app", 8080)
+
+	spec := BlueGreenBuildSpecTemplate("123456789012.dkr.ecr.ap-northeast-1.amazonaws.com", "ap-northeast-1", "app-prod", taskDef, appSpec)
+	assert.Contains(t, spec, "    - imageDetail.json\n    - taskdef.json\n    - appspec.yaml\n")
+
+	written := map[string]string{}
+	for _, m := range regexp.MustCompile(`echo (\S+) \| base64 -d > (\S+)`).FindAllStringSubmatch(spec, -1) {
+		b, err := base64.StdEncoding.DecodeString(m[1])
+		assert.NoError(t, err)
+		written[m[2]] = string(b)
+	}
+	assert.Equal(t, appSpec, written["appspec.yaml"])
+
+	var td struct {
+		Family               string                `json:"family"`
+		ContainerDefinitions []ContainerDefinition `json:"containerDefinitions"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(written["taskdef.json"]), &td))
+	assert.Equal(t, "app-prod", td.Family)
+	assert.Equal(t, CODEDEPLOY_IMAGE_PLACEHOLDER, td.ContainerDefinitions[0].Image)
+	assert.Equal(t, `'"`, td.ContainerDefinitions[0].Environment[0].Value)
+}
+
+func TestBlueGreenArgsDefaults(t *testing.T) {
+	_, err := BlueGreenArgs{}.withDefaults("api-dev")
+	assert.Error(t, err)
+
+	b, err := BlueGreenArgs{ServiceRole: "role"}.withDefaults("api-dev")
+	assert.NoError(t, err)
+	assert.Equal(t, 8443, b.TestListenerPort)
+	assert.Equal(t, 5, b.TerminationWaitMinutes)
+	assert.Equal(t, TRAFFIC_ALL_AT_ONCE, b.Traffic.Type)
+
+	_, err = BlueGreenArgs{ServiceRole: "role", Traffic: TrafficShifting{Type: TRAFFIC_CANARY, Percentage: 100, IntervalMinutes: 5}}.withDefaults("api-dev")
+	assert.Error(t, err)
+	_, err = BlueGreenArgs{ServiceRole: "role", Traffic: TrafficShifting{Type: TRAFFIC_LINEAR, Percentage: 10, IntervalMinutes: 1}}.withDefaults("api-dev")
+	assert.NoError(t, err)
+
+	// 26 characters fit, the green target group adds six.
+	_, err = BlueGreenArgs{ServiceRole: "role"}.withDefaults("payment-gateway-production")
+	assert.NoError(t, err)
+	_, err = BlueGreenArgs{ServiceRole: "role"}.withDefaults("payment-gateway-productions")
+	assert.Error(t, err)
+}
@@ -1,135 +1,97 @@
 package dulumi
 
 import (
-	"bytes"
-	"text/template"
+	"fmt"
 )
 
+// ContainerDefinitionTemplate renders the app container, followed by a
+// fluent-bit log router when appEnableLogrouter is set and by the sidecars.
+// Sidecars without a log configuration log like the app container. The app
+// container has no health check when healthCheck is nil.
 func ContainerDefinitionTemplate(
 	appImage string,
-	appPort string,
+	appPort int,
 	awsLogsGroup string,
+	awsLogsRegion string,
 	appEnvs map[string]string,
 	secretArn *string,
 	appSecrets map[string]string,
 	logRouterEnvs map[string]string,
 	appEnableLogrouter bool,
-) string {
-
-	type ContainerParameter struct {
-		AppImage, AppPort, AwsLogsGroup, AppEnvs, AppSecrets, LogRouterEnvs string
-		AppEnableLogrouter                                                  bool
+	logRouterImage string,
+	healthCheck *HealthCheck,
+	sidecars ...ContainerDefinition,
+) (string, error) {
+	if appPort <= 0 || appPort > 65535 {
+		return "", fmt.Errorf("container definition: invalid app port %v", appPort)
+	}
+	if len(appSecrets) > 0 && secretArn == nil {
+		return "", fmt.Errorf("container definition: app secrets need a secret ARN")
 	}
 
-	envs := ContainerEnvs(appEnvs)
-
-	secrets := ContainerSecrets(appSecrets, secretArn)
-
-	logEnvs := ContainerEnvs(logRouterEnvs)
-
-	param := ContainerParameter{
-		appImage,
-		appPort,
-		awsLogsGroup,
-		ContainerEnvJsonArray(envs),
-		ContainerEnvJsonArray(secrets),
-		ContainerEnvJsonArray(logEnvs),
-		appEnableLogrouter,
+	essential := true
+	nofile := []Ulimit{{Name: "nofile", SoftLimit: 65535, HardLimit: 65535}}
+	awsLogs := func(prefix string) *LogConfiguration {
+		return &LogConfiguration{
+			LogDriver: "awslogs",
+			Options: map[string]string{
+				"awslogs-group":         awsLogsGroup,
+				"awslogs-region":        awsLogsRegion,
+				"awslogs-stream-prefix": prefix,
+			},
+		}
 	}
 
-	t := template.Must(template.New("containerDefinition").Parse(definition))
-	var buf bytes.Buffer
-	err := t.Execute(&buf, param)
-	if err != nil {
-		panic("invalid containerDefinition")
+	app := ContainerDefinition{
+		Name:  "app",
+		Image: appImage,
+		PortMappings: []PortMapping{
+			{ContainerPort: appPort, HostPort: appPort, Protocol: "tcp"},
+		},
+		Environment:      ContainerEnvs(appEnvs),
+		Ulimits:          nofile,
+		Secrets:          ContainerSecrets(appSecrets, secretArn),
+		HealthCheck:      healthCheck,
+		Essential:        &essential,
+		LogConfiguration: awsLogs("app"),
+	}
+	withSidecars := func(definitions ...ContainerDefinition) (string, error) {
+		for _, s := range sidecars {
+			if s.LogConfiguration == nil {
+				if appEnableLogrouter {
+					s.LogConfiguration = &LogConfiguration{LogDriver: "awsfirelens"}
+				} else {
+					s.LogConfiguration = awsLogs(s.Name)
+				}
+			}
+			definitions = append(definitions, s)
+		}
+		return MarshalContainerDefinitions(definitions)
+	}
+	if !appEnableLogrouter {
+		return withSidecars(app)
 	}
-	return buf.String()
-}
 
-const definition = `[
-  {
-    "name": "app",
-    "image": "{{.AppImage}}",
-    "portMappings": [
-      {
-        "containerPort": {{.AppPort}},
-        "hostPort": {{.AppPort}},
-        "protocol": "tcp"
-      }
-    ],
-    "environment": [
-        {{.AppEnvs}}
-    ],
-    "ulimits": [{
-      "name": "nofile",
-      "softLimit": 65535,
-      "hardLimit": 65535
-    }],
-    "secrets": [
-        {{.AppSecrets}}
-    ],
-    "healthCheck": {
-      "retries": 3,
-      "command": [
-        "CMD-SHELL",
-        "echo hello"
-      ],
-      "timeout": 5,
-      "interval": 30
-    },
-    "essential": true,
-{{if .AppEnableLogrouter}}
-    "logConfiguration": {
-      "logDriver": "awsfirelens"
-    }
-},
-{{else}}
-    "logConfiguration": {
-      "logDriver": "awslogs",
-      "options": {
-        "awslogs-group": "{{.AwsLogsGroup}}",
-        "awslogs-region": "ap-northeast-1",
-        "awslogs-stream-prefix": "app"
-      }
-    }
+	app.LogConfiguration = &LogConfiguration{LogDriver: "awsfirelens"}
+	cpu := 0
+	logRouter := ContainerDefinition{
+		Name:  "log-router",
+		Image: logRouterImage,
+		Cpu:   &cpu,
+		User:  "0",
+		PortMappings: []PortMapping{
+			{ContainerPort: 24224, HostPort: 24224, Protocol: "tcp"},
+		},
+		Environment:      ContainerEnvs(logRouterEnvs),
+		Ulimits:          nofile,
+		LogConfiguration: awsLogs("fluentbit"),
+		FirelensConfiguration: &FirelensConfiguration{
+			Type: "fluentbit",
+			Options: map[string]string{
+				"config-file-type":  "file",
+				"config-file-value": "/fluent-bit/etc/drama-fluent-bit.conf",
+			},
+		},
+	}
+	return withSidecars(app, logRouter)
 }
-{{end}}
-{{if .AppEnableLogrouter}}
-  {
-    "logConfiguration": {
-      "logDriver": "awslogs",
-      "options": {
-        "awslogs-group": "{{.AwsLogsGroup}}",
-        "awslogs-region": "ap-northeast-1",
-        "awslogs-stream-prefix": "fluentbit"
-      }
-    },
-    "portMappings": [
-      {
-        "hostPort": 24224,
-        "protocol": "tcp",
-        "containerPort": 24224
-      }
-    ],
-    "cpu": 0,
-    "ulimits": [{
-      "name": "nofile",
-      "softLimit": 65535,
-      "hardLimit": 65535
-    }],
-    "environment": [
-        {{.LogRouterEnvs}}
-    ],
-    "image": "784015586554.dkr.ecr.ap-northeast-1.amazonaws.com/drama-aws-fluent-bit:latest",
-    "firelensConfiguration": {
-      "type": "fluentbit",
-      "options": {
-        "config-file-type": "file",
-        "config-file-value": "/fluent-bit/etc/drama-fluent-bit.conf"
-      }
-    },
-    "user": "0",
-    "name": "log-router"
-  }
-{{end}}
-]`
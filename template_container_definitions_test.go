@@ -0,0 +1,110 @@
+package dulumi
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestContainerDefinitionTemplateStable(t *testing.T) {
+	secretArn := "arn:aws:secretsmanager:ap-northeast-1:123456789012:secret:app"
+	render := func() string {
+		s, err := ContainerDefinitionTemplate(
+			"123456789012.dkr.ecr.ap-northeast-1.amazonaws.com/app:latest",
+			8080,
+			"app",
+			"ap-northeast-1",
+			map[string]string{"C": "3", "A": "1", "B": "2", "D": "4", "E": "5"},
+			&secretArn,
+			map[string]string{"TOKEN": "", "PASSWORD": "", "API_KEY": ""},
+			map[string]string{"Z": "26", "Y": "25", "X": "24"},
+			true,
+			"fluent-bit:latest",
+			nil,
+		)
+		assert.NoError(t, err)
+		return s
+	}
+
+	first := render()
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, first, render())
+	}
+
+	var defs []ContainerDefinition
+	assert.NoError(t, json.Unmarshal([]byte(first), &defs))
+	assert.Equal(t, []KeyValuePair{{"A", "1"}, {"B", "2"}, {"C", "3"}, {"D", "4"}, {"E", "5"}}, defs[0].Environment)
+	assert.Equal(t, []Secret{
+		{"API_KEY", secretArn + ":API_KEY::"},
+		{"PASSWORD", secretArn + ":PASSWORD::"},
+		{"TOKEN", secretArn + ":TOKEN::"},
+	}, defs[0].Secrets)
+	assert.Equal(t, []KeyValuePair{{"X", "24"}, {"Y", "25"}, {"Z", "26"}}, defs[1].Environment)
+}
+
+func TestContainerDefinitionTemplateEscaping(t *testing.T) {
+	s, err := ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		map[string]string{"MOTD": "say \"hi\"\\\nbye"}, nil, nil, nil, false, "", nil)
+	assert.NoError(t, err)
+
+	var defs []ContainerDefinition
+	assert.NoError(t, json.Unmarshal([]byte(s), &defs))
+	assert.Equal(t, "say \"hi\"\\\nbye", defs[0].Environment[0].Value)
+	assert.Len(t, defs, 1)
+}
+
+func TestContainerDefinitionTemplateErrors(t *testing.T) {
+	_, err := ContainerDefinitionTemplate("app:latest", 0, "app", "ap-northeast-1",
+		nil, nil, nil, nil, false, "", nil)
+	assert.Error(t, err)
+
+	_, err = ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		nil, nil, map[string]string{"TOKEN": ""}, nil, false, "", nil)
+	assert.Error(t, err)
+
+	_, err = ContainerDefinitionTemplate("", 80, "app", "ap-northeast-1",
+		nil, nil, nil, nil, false, "", nil)
+	assert.Error(t, err)
+}
+
+func TestContainerDefinitionTemplateSidecars(t *testing.T) {
+	essential := false
+	agent := Sidecar{
+		Name:         "datadog-agent",
+		Image:        "datadog/agent:7",
+		Essential:    &essential,
+		Envs:         map[string]string{"ECS_FARGATE": "true"},
+		Secrets:      map[string]string{"DD_API_KEY": "arn:aws:ssm:ap-northeast-1:123456789012:parameter/dd"},
+		PortMappings: []PortMapping{{ContainerPort: 8126, Protocol: "tcp"}},
+		DependsOn:    []ContainerDependency{{ContainerName: "log-router", Condition: "START"}},
+	}
+
+	s, err := ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		nil, nil, nil, nil, true, "fluent-bit:latest", nil, agent.ContainerDefinition())
+	assert.NoError(t, err)
+
+	var defs []ContainerDefinition
+	assert.NoError(t, json.Unmarshal([]byte(s), &defs))
+	assert.Len(t, defs, 3)
+	assert.Equal(t, "datadog-agent", defs[2].Name)
+	assert.Equal(t, false, *defs[2].Essential)
+	assert.Equal(t, "awsfirelens", defs[2].LogConfiguration.LogDriver)
+	assert.Equal(t, []Secret{{"DD_API_KEY", "arn:aws:ssm:ap-northeast-1:123456789012:parameter/dd"}}, defs[2].Secrets)
+
+	_, err = ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		nil, nil, nil, nil, false, "", nil, agent.ContainerDefinition())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown container "log-router"`)
+
+	agent.DependsOn = nil
+	s, err = ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		nil, nil, nil, nil, false, "", nil, agent.ContainerDefinition())
+	assert.NoError(t, err)
+	defs = nil
+	assert.NoError(t, json.Unmarshal([]byte(s), &defs))
+	assert.Equal(t, "datadog-agent", defs[1].LogConfiguration.Options["awslogs-stream-prefix"])
+
+	_, err = ContainerDefinitionTemplate("app:latest", 80, "app", "ap-northeast-1",
+		nil, nil, nil, nil, false, "", nil, Sidecar{Name: "app", Image: "envoy"}.ContainerDefinition())
+	assert.Error(t, err)
+}
@@ -0,0 +1,134 @@
+package utils
+
+import (
+	"fmt"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+	"github.com/pulumi/pulumi/sdk/v2/go/pulumi/config"
+)
+
+// AutoTagConfig is the shape of the auto tagging settings in a stack config
+// namespace, e.g.
+//
+//	config:
+//	  dulumi:tags:
+//	    Team: platform
+//	    CostCenter: "1234"
+//	  dulumi:tagPolicy:
+//	    required: [Team, CostCenter]
+//	  dulumi:ignoreChanges:
+//	    - types: [aws:ecs/service:Service]
+//	      props: [taskDefinition]
+//	  dulumi:resourceRules:
+//	    - types: [aws:ecr/repository:Repository, aws:secretsmanager/secret:Secret]
+//	      stacks: [prod*]
+//	      protect: true
+type AutoTagConfig struct {
+	Tags          map[string]string `json:"tags"`
+	TagPolicy     *TagPolicy        `json:"tagPolicy"`
+	TagSanitizing *TagSanitizing    `json:"tagSanitizing"`
+	IgnoreChanges []IgnoreRule      `json:"ignoreChanges"`
+	ResourceRules []ResourceRule    `json:"resourceRules"`
+}
+
+// IgnoreRule holds the arguments of one IgnoreChanges call.
+type IgnoreRule struct {
+	Global bool     `json:"global"`
+	Types  []string `json:"types"`
+	Props  []string `json:"props"`
+}
+
+// LoadAutoTagConfig reads the auto tagging settings of the given stack config
+// namespace. Missing keys are left empty.
+func LoadAutoTagConfig(ctx *plm.Context, namespace string) (*AutoTagConfig, error) {
+	cfg := config.New(ctx, namespace)
+
+	var c AutoTagConfig
+	if err := cfg.GetObject("tags", &c.Tags); err != nil {
+		return nil, fmt.Errorf("config %v:tags: %w", namespace, err)
+	}
+	if err := cfg.GetObject("tagPolicy", &c.TagPolicy); err != nil {
+		return nil, fmt.Errorf("config %v:tagPolicy: %w", namespace, err)
+	}
+	if err := cfg.GetObject("tagSanitizing", &c.TagSanitizing); err != nil {
+		return nil, fmt.Errorf("config %v:tagSanitizing: %w", namespace, err)
+	}
+	if err := cfg.GetObject("ignoreChanges", &c.IgnoreChanges); err != nil {
+		return nil, fmt.Errorf("config %v:ignoreChanges: %w", namespace, err)
+	}
+	if err := cfg.GetObject("resourceRules", &c.ResourceRules); err != nil {
+		return nil, fmt.Errorf("config %v:resourceRules: %w", namespace, err)
+	}
+	return &c, nil
+}
+
+// TagTransformation returns a transformation merging defaults overlaid with
+// the configured tags, under the configured tag policy and sanitizing. Pass it
+// to a component through plm.Transformations to tag only its children.
+func (c *AutoTagConfig) TagTransformation(ctx *plm.Context, defaults plm.StringMap,
+	opts ...AutoTagOption) (plm.ResourceTransformation, error) {
+	tags, opts := c.autoTagArgs(defaults, opts)
+	return AutoTagTransformation(ctx, tags, opts...)
+}
+
+// ResourceOptions returns the options the configured resource rules and
+// ignore rules give a resource of type t named name, declared in a component
+// of type parentType. Components pass them to each child when declaring it:
+// the SDK keeps only the options of the last transformation that changes a
+// resource, so options a component transformation adds are dropped as soon
+// as a stack transformation, such as auto tags, changes the resource too.
+func (c *AutoTagConfig) ResourceOptions(ctx *plm.Context, t, name, parentType string) []plm.ResourceOption {
+	opts := ResourceRulesOptions(ctx, t, name, parentType, c.ResourceRules...)
+	for _, r := range c.IgnoreChanges {
+		opts = append(opts, IgnoreChangesOptions(r.Global, r.Types, r.Props, t)...)
+	}
+	return opts
+}
+
+// autoTagArgs returns defaults overlaid with the configured tags, and opts
+// with the configured tag policy and sanitizing.
+func (c *AutoTagConfig) autoTagArgs(defaults plm.StringMap, opts []AutoTagOption) (plm.StringMap, []AutoTagOption) {
+	tags := plm.StringMap{}
+	for k, v := range defaults {
+		tags[k] = v
+	}
+	for k, v := range c.Tags {
+		tags[k] = plm.String(v)
+	}
+
+	if c.TagPolicy != nil {
+		opts = append(opts, WithTagPolicy(*c.TagPolicy))
+	}
+	if c.TagSanitizing != nil {
+		opts = append(opts, WithTagSanitizing(*c.TagSanitizing))
+	}
+	return tags, opts
+}
+
+// RegisterAutoTagsFromConfig registers the resource rules, auto tags, tag
+// policy and ignore rules declared in the given stack config namespace, with
+// the same guarantees as RegisterResourceRules, RegisterAutoTags and
+// IgnoreChanges.
+func RegisterAutoTagsFromConfig(ctx *plm.Context, namespace string, opts ...AutoTagOption) error {
+	c, err := LoadAutoTagConfig(ctx, namespace)
+	if err != nil {
+		return report(ctx, err)
+	}
+
+	if len(c.ResourceRules) > 0 {
+		if err := RegisterResourceRules(ctx, c.ResourceRules...); err != nil {
+			return err
+		}
+	}
+
+	tags, opts := c.autoTagArgs(nil, opts)
+	if err := RegisterAutoTags(ctx, tags, opts...); err != nil {
+		return err
+	}
+	for _, r := range c.IgnoreChanges {
+		if err := IgnoreChanges(ctx, r.Global, r.Types, r.Props); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"reflect"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// OptionValues collects the value each of opts leaves in field of the
+// resource options, such as "Parent" or "IgnoreChanges". The SDK keeps
+// resolved options private, so each option is replayed against a fresh copy
+// of its own options struct.
+func OptionValues(opts []plm.ResourceOption, field string) []interface{} {
+	var values []interface{}
+	for _, o := range opts {
+		fn := reflect.ValueOf(o)
+		if fn.Kind() != reflect.Func || fn.Type().NumIn() == 0 {
+			continue
+		}
+		in := make([]reflect.Value, fn.Type().NumIn())
+		for i := range in {
+			in[i] = reflect.Zero(fn.Type().In(i))
+		}
+		options := reflect.New(fn.Type().In(0).Elem())
+		in[0] = options
+		fn.Call(in)
+
+		if v := options.Elem().FieldByName(field); v.IsValid() {
+			values = append(values, v.Interface())
+		}
+	}
+	return values
+}
+
+// parentOf finds the resource passed through plm.Parent among the options.
+func parentOf(opts []plm.ResourceOption) plm.Resource {
+	var parent plm.Resource
+	for _, v := range OptionValues(opts, "Parent") {
+		if p, ok := v.(plm.Resource); ok && p != nil {
+			parent = p
+		}
+	}
+	return parent
+}
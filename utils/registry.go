@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"sync"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// registrations holds the stack transformations registered per program, so
+// that repeated calls do not stack duplicates.
+var registrations = struct {
+	sync.Mutex
+	byContext map[*plm.Context]*stackTransformations
+}{byContext: map[*plm.Context]*stackTransformations{}}
+
+type stackTransformations struct {
+	keys            map[string]bool
+	transformations []plm.ResourceTransformation
+}
+
+// registerOnce adds t to the stack transformations of ctx unless key has
+// already been registered, and reports whether it did. They all run as one
+// chained stack transformation, registered along with the first of them.
+func registerOnce(ctx *plm.Context, key string, t plm.ResourceTransformation) (bool, error) {
+	registrations.Lock()
+	defer registrations.Unlock()
+
+	st := registrations.byContext[ctx]
+	if st == nil {
+		st = &stackTransformations{keys: map[string]bool{}}
+		if err := ctx.RegisterStackTransformation(st.transform); err != nil {
+			return true, err
+		}
+		registrations.byContext[ctx] = st
+	}
+	if st.keys[key] {
+		return false, nil
+	}
+
+	st.keys[key] = true
+	st.transformations = append(st.transformations, t)
+	return true, nil
+}
+
+func (st *stackTransformations) transform(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+	registrations.Lock()
+	transformations := append([]plm.ResourceTransformation(nil), st.transformations...)
+	registrations.Unlock()
+
+	return ChainTransformations(transformations...)(args)
+}
+
+// ChainTransformations combines transformations into one that hands each of
+// them the props and options returned by the one before. The SDK passes every
+// transformation the original options instead, so only the options added by
+// the last one would survive.
+func ChainTransformations(transformations ...plm.ResourceTransformation) plm.ResourceTransformation {
+	return func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+		props, opts := args.Props, args.Opts
+		changed := false
+		for _, t := range transformations {
+			res := t(&plm.ResourceTransformationArgs{
+				Resource: args.Resource,
+				Type:     args.Type,
+				Name:     args.Name,
+				Props:    props,
+				Opts:     opts,
+			})
+			if res != nil {
+				props, opts, changed = res.Props, res.Opts, true
+			}
+		}
+		if !changed {
+			return nil
+		}
+
+		return &plm.ResourceTransformationResult{
+			Props: props,
+			Opts:  opts,
+		}
+	}
+}
+
+// Run runs body like plm.Run, reporting the tag coverage and releasing what
+// this package kept for the program as RunErr does.
+func Run(body plm.RunFunc, opts ...plm.RunOption) {
+	var ctx *plm.Context
+	plm.Run(program(body, &ctx), opts...)
+	release(ctx)
+}
+
+// RunErr runs body like plm.RunErr. Once body has declared its resources, the
+// coverage of the auto tags is reported with ReportTagCoverage, and when the
+// program is done what this package kept for it is released: its stack
+// transformations and tag coverage. Programs run through plm directly keep
+// them for the life of the process, which only matters to processes that run
+// many programs, such as tests.
+func RunErr(body plm.RunFunc, opts ...plm.RunOption) error {
+	var ctx *plm.Context
+	defer func() { release(ctx) }()
+	return plm.RunErr(program(body, &ctx), opts...)
+}
+
+// program stores the context body runs with in ctx, and reports the tag
+// coverage once body succeeds, if the auto tags saw any resource.
+func program(body plm.RunFunc, ctx **plm.Context) plm.RunFunc {
+	return func(c *plm.Context) error {
+		*ctx = c
+		if err := body(c); err != nil {
+			return err
+		}
+		if len(GetTagCoverage(c)) == 0 {
+			return nil
+		}
+		return ReportTagCoverage(c)
+	}
+}
+
+// release forgets everything kept for ctx.
+func release(ctx *plm.Context) {
+	if ctx == nil {
+		return
+	}
+
+	registrations.Lock()
+	delete(registrations.byContext, ctx)
+	registrations.Unlock()
+
+	coverage.Lock()
+	delete(coverage.byContext, ctx)
+	coverage.Unlock()
+}
+
+// report sends err to the Pulumi CLI output before returning it.
+func report(ctx *plm.Context, err error) error {
+	if err != nil {
+		_ = ctx.Log.Error(err.Error(), nil)
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// ResourceRule applies resource options to every resource it matches. The
+// match fields hold patterns as in IgnoreChangesByType; a resource must match
+// one pattern of every field that is set.
+type ResourceRule struct {
+	Types []string `json:"types"`
+	Names []string `json:"names"`
+	// Parents matches the type of the component the resource is declared in.
+	Parents []string `json:"parents"`
+	Stacks  []string `json:"stacks"`
+	// Tags matches tag values declared as plain strings on the resource.
+	// Auto tags turn tags into outputs, so register rules that match on tags
+	// before them.
+	Tags map[string]string `json:"tags"`
+
+	Protect                 bool                `json:"protect"`
+	DeleteBeforeReplace     bool                `json:"deleteBeforeReplace"`
+	CustomTimeouts          *plm.CustomTimeouts `json:"customTimeouts"`
+	IgnoreChanges           []string            `json:"ignoreChanges"`
+	AdditionalSecretOutputs []string            `json:"additionalSecretOutputs"`
+}
+
+// RegisterResourceRules applies rules to every resource declared after it.
+// Registering the same rules twice is a no-op. Errors are also reported to the
+// Pulumi CLI output.
+func RegisterResourceRules(ctx *plm.Context, rules ...ResourceRule) error {
+	key, err := json.Marshal(rules)
+	if err != nil {
+		return report(ctx, fmt.Errorf("register resource rules: %w", err))
+	}
+
+	if _, err := registerOnce(ctx, "resourceRules:"+string(key), ResourceRulesTransformation(ctx, rules...)); err != nil {
+		return report(ctx, fmt.Errorf("register resource rules: %w", err))
+	}
+	return nil
+}
+
+// ResourceRulesTransformation returns the transformation RegisterResourceRules
+// registers for the whole stack. Components should pass ResourceRulesOptions
+// to their children instead, see AutoTagConfig.ResourceOptions.
+func ResourceRulesTransformation(ctx *plm.Context, rules ...ResourceRule) plm.ResourceTransformation {
+	var compiled []compiledResourceRule
+	for _, r := range rules {
+		compiled = append(compiled, r.compile())
+	}
+
+	// The SDK does not expose the type of a resource, so the types of the
+	// components are remembered as they pass through.
+	var mu sync.Mutex
+	types := map[plm.Resource]string{}
+
+	return func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+		mu.Lock()
+		types[args.Resource] = args.Type
+		var parentType string
+		if parent := parentOf(args.Opts); parent != nil {
+			parentType = types[parent]
+		}
+		mu.Unlock()
+
+		opts := args.Opts
+		for _, r := range compiled {
+			if r.matches(ctx, args.Type, args.Name, parentType, args.Props) {
+				opts = append(opts, r.options()...)
+			}
+		}
+		if len(opts) == len(args.Opts) {
+			return nil
+		}
+
+		return &plm.ResourceTransformationResult{
+			Props: args.Props,
+			Opts:  opts,
+		}
+	}
+}
+
+// ResourceRulesOptions returns the options rules give a resource of type t
+// named name, declared in a component of type parentType. Rules that match on
+// tags do not match, as the tags of the resource are not known yet.
+func ResourceRulesOptions(ctx *plm.Context, t, name, parentType string, rules ...ResourceRule) []plm.ResourceOption {
+	var opts []plm.ResourceOption
+	for _, r := range rules {
+		if compiled := r.compile(); compiled.matches(ctx, t, name, parentType, nil) {
+			opts = append(opts, compiled.options()...)
+		}
+	}
+	return opts
+}
+
+type compiledResourceRule struct {
+	ResourceRule
+	types, names, parents, stacks []*regexp.Regexp
+	tags                          map[string]*regexp.Regexp
+}
+
+func (r ResourceRule) compile() compiledResourceRule {
+	compileAll := func(patterns []string) []*regexp.Regexp {
+		var res []*regexp.Regexp
+		for _, p := range patterns {
+			res = append(res, compilePattern(p))
+		}
+		return res
+	}
+
+	tags := map[string]*regexp.Regexp{}
+	for k, p := range r.Tags {
+		tags[k] = compilePattern(p)
+	}
+	return compiledResourceRule{
+		ResourceRule: r,
+		types:        compileAll(r.Types),
+		names:        compileAll(r.Names),
+		parents:      compileAll(r.Parents),
+		stacks:       compileAll(r.Stacks),
+		tags:         tags,
+	}
+}
+
+func (r compiledResourceRule) matches(ctx *plm.Context, t, name, parentType string, props plm.Input) bool {
+	matchAny := func(patterns []*regexp.Regexp, s string) bool {
+		if len(patterns) == 0 {
+			return true
+		}
+		for _, re := range patterns {
+			if re.MatchString(s) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if !matchAny(r.types, t) || !matchAny(r.names, name) ||
+		!matchAny(r.parents, parentType) || !matchAny(r.stacks, ctx.Stack()) {
+		return false
+	}
+	if len(r.tags) == 0 {
+		return true
+	}
+
+	tags := staticTags(props)
+	for k, re := range r.tags {
+		v, ok := tags[k]
+		if !ok || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r compiledResourceRule) options() []plm.ResourceOption {
+	var opts []plm.ResourceOption
+	if r.Protect {
+		opts = append(opts, plm.Protect(true))
+	}
+	if r.DeleteBeforeReplace {
+		opts = append(opts, plm.DeleteBeforeReplace(true))
+	}
+	if r.CustomTimeouts != nil {
+		opts = append(opts, plm.Timeouts(r.CustomTimeouts))
+	}
+	if len(r.IgnoreChanges) > 0 {
+		opts = append(opts, plm.IgnoreChanges(r.IgnoreChanges))
+	}
+	if len(r.AdditionalSecretOutputs) > 0 {
+		opts = append(opts, plm.AdditionalSecretOutputs(r.AdditionalSecretOutputs))
+	}
+	return opts
+}
+
+// staticTags returns the tags of the resource args that are known without
+// waiting on outputs.
+func staticTags(props plm.Input) map[string]string {
+	tags := map[string]string{}
+	v := reflect.ValueOf(props)
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return tags
+	}
+
+	field := v.Elem().FieldByName("Tags")
+	if !field.IsValid() || field.Kind() != reflect.Interface || field.IsNil() {
+		return tags
+	}
+	m, ok := field.Interface().(plm.StringMap)
+	if !ok {
+		return tags
+	}
+	for k, v := range m {
+		if s, ok := v.(plm.String); ok {
+			tags[k] = string(s)
+		}
+	}
+	return tags
+}
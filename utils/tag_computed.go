@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"reflect"
+	"unicode/utf8"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// TagFunc computes the value of an auto tag for the resource being
+// registered.
+type TagFunc func(ctx *plm.Context, args *plm.ResourceTransformationArgs) plm.StringInput
+
+// WithComputedTags adds auto tags whose values are derived from each
+// resource. They are merged like the static auto tags, which they override
+// on a shared key.
+func WithComputedTags(tags map[string]TagFunc) AutoTagOption {
+	return func(o *autoTagOptions) {
+		if o.computed == nil {
+			o.computed = map[string]TagFunc{}
+		}
+		for k, f := range tags {
+			o.computed[k] = f
+		}
+	}
+}
+
+// PulumiResourceTags returns computed tags that trace a cloud resource back
+// to the stack, project and component that owns it. Name is only filled in
+// for resources that do not declare one, as it is the name AWS consoles show.
+func PulumiResourceTags() map[string]TagFunc {
+	return map[string]TagFunc{
+		"PulumiUrn": func(ctx *plm.Context, args *plm.ResourceTransformationArgs) plm.StringInput {
+			return resourceURN(ctx, args).ApplyT(urnTagValue).(plm.StringOutput)
+		},
+		"PulumiType": func(_ *plm.Context, args *plm.ResourceTransformationArgs) plm.StringInput {
+			return plm.String(args.Type)
+		},
+		"PulumiStack": func(ctx *plm.Context, _ *plm.ResourceTransformationArgs) plm.StringInput {
+			return plm.String(ctx.Stack())
+		},
+		"PulumiProject": func(ctx *plm.Context, _ *plm.ResourceTransformationArgs) plm.StringInput {
+			return plm.String(ctx.Project())
+		},
+		"Name": nameTag,
+	}
+}
+
+// nameTag returns the Name tag declared in the Tags map of the resource, or
+// its logical name when there is none.
+func nameTag(_ *plm.Context, args *plm.ResourceTransformationArgs) plm.StringInput {
+	props := reflect.ValueOf(args.Props)
+	if !props.IsValid() || props.Kind() != reflect.Ptr || props.IsNil() || props.Elem().Kind() != reflect.Struct {
+		return plm.String(args.Name)
+	}
+	field := props.Elem().FieldByName("Tags")
+	if !field.IsValid() || field.Kind() != reflect.Interface || field.IsNil() {
+		return plm.String(args.Name)
+	}
+	tags, ok := field.Interface().(plm.StringMapInput)
+	if !ok {
+		return plm.String(args.Name)
+	}
+
+	return tags.ToStringMapOutput().ApplyT(func(tags map[string]string) string {
+		if name, ok := tags["Name"]; ok {
+			return name
+		}
+		return args.Name
+	}).(plm.StringOutput)
+}
+
+// urnTagValue makes a URN fit a tag value. The URNs of resources inside
+// components contain `$`, which AWS rejects, and long ones keep their end,
+// which names the resource.
+func urnTagValue(urn string) string {
+	urn = invalidTagChars.ReplaceAllString(urn, "_")
+	if n := utf8.RuneCountInString(urn); n > maxTagValueLength {
+		urn = string([]rune(urn)[n-maxTagValueLength:])
+	}
+	return urn
+}
+
+// resourceAutoTags returns the auto tags of one resource, the static ones
+// followed by the computed ones.
+func (t *autoTagger) resourceAutoTags(args *plm.ResourceTransformationArgs) plm.StringMap {
+	if len(t.options.computed) == 0 {
+		return t.autoTags
+	}
+
+	tags := plm.StringMap{}
+	for k, v := range t.autoTags {
+		tags[k] = v
+	}
+	for k, f := range t.options.computed {
+		tags[k] = f(t.ctx, args)
+	}
+	return tags
+}
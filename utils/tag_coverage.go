@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// TagCounts counts the resources of one type the auto tagger has seen.
+type TagCounts struct {
+	// Tagged resources only carry the auto tags.
+	Tagged int `json:"tagged"`
+	// AlreadyTagged resources declared tags of their own, which were merged
+	// with the auto tags.
+	AlreadyTagged int `json:"alreadyTagged"`
+	// Untaggable resources have no field the auto tags could go into.
+	Untaggable int `json:"untaggable"`
+}
+
+// TagCoverage holds the TagCounts of every resource type.
+type TagCoverage map[string]TagCounts
+
+type coverageKind int
+
+const (
+	autoTagged coverageKind = iota
+	alreadyTagged
+	untaggable
+)
+
+var coverage = struct {
+	sync.Mutex
+	byContext map[*plm.Context]*contextCoverage
+}{byContext: map[*plm.Context]*contextCoverage{}}
+
+type contextCoverage struct {
+	counts TagCoverage
+	// seen holds the resources already counted, as a component tagger and
+	// the stack tagger both see the children of the component.
+	seen map[plm.Resource]bool
+}
+
+// recordCoverage counts a custom resource the first time an auto tagger sees
+// it. Components are skipped, they are never tagged.
+func recordCoverage(ctx *plm.Context, args *plm.ResourceTransformationArgs, kind coverageKind) {
+	if _, ok := args.Resource.(plm.CustomResource); !ok {
+		return
+	}
+
+	coverage.Lock()
+	defer coverage.Unlock()
+
+	c := coverage.byContext[ctx]
+	if c == nil {
+		c = &contextCoverage{counts: TagCoverage{}, seen: map[plm.Resource]bool{}}
+		coverage.byContext[ctx] = c
+	}
+	if c.seen[args.Resource] {
+		return
+	}
+	c.seen[args.Resource] = true
+
+	counts := c.counts[args.Type]
+	switch kind {
+	case autoTagged:
+		counts.Tagged++
+	case alreadyTagged:
+		counts.AlreadyTagged++
+	case untaggable:
+		counts.Untaggable++
+	}
+	c.counts[args.Type] = counts
+}
+
+// GetTagCoverage returns a copy of the coverage recorded so far, e.g. to be
+// exported as a stack output.
+func GetTagCoverage(ctx *plm.Context) TagCoverage {
+	coverage.Lock()
+	defer coverage.Unlock()
+
+	res := TagCoverage{}
+	if c := coverage.byContext[ctx]; c != nil {
+		for k, v := range c.counts {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// ReportTagCoverage logs the coverage of the auto tags, one line per resource
+// type. Run and RunErr call it once the program has declared its resources;
+// programs run through plm directly call it themselves at the end.
+func ReportTagCoverage(ctx *plm.Context) error {
+	c := GetTagCoverage(ctx)
+
+	var lines []string
+	for _, k := range sortedKeys(c) {
+		lines = append(lines, fmt.Sprintf("%v: %v tagged, %v already tagged, %v untaggable",
+			k, c[k].Tagged, c[k].AlreadyTagged, c[k].Untaggable))
+	}
+	if len(lines) == 0 {
+		return ctx.Log.Info("tag coverage: no resources seen", nil)
+	}
+	return ctx.Log.Info("tag coverage:\n"+strings.Join(lines, "\n"), nil)
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits AWS enforces on the tags of a resource.
+const (
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+	maxTags           = 50
+)
+
+// invalidTagChars matches the characters AWS does not allow in tag keys and
+// values: anything but letters, numbers, spaces and `_ . : / = + - @`.
+var invalidTagChars = regexp.MustCompile(`[^\p{L}\p{Z}\p{N}_.:/=+\-@]`)
+
+// TagSanitizing normalises tags before they are checked against the AWS
+// limits, which they would otherwise fail.
+type TagSanitizing struct {
+	// Trim removes leading and trailing spaces from keys and values.
+	Trim bool `json:"trim"`
+	// Replacement replaces every character AWS does not allow, when set.
+	Replacement string `json:"replacement"`
+	// Truncate shortens keys and values that are too long.
+	Truncate bool `json:"truncate"`
+}
+
+// WithTagSanitizing normalises the merged tags of every resource. Tags that
+// still break the AWS limits afterwards fail the resource, as do characters
+// AWS does not allow when there is no Replacement. Without sanitizing those
+// characters are left for AWS to reject, as some services accept them.
+func WithTagSanitizing(sanitizing TagSanitizing) AutoTagOption {
+	return func(o *autoTagOptions) {
+		o.sanitizing = &sanitizing
+	}
+}
+
+// sanitize normalises every key and value of tags. It fails when two keys
+// end up the same, as only one of their values could be kept.
+func (s *TagSanitizing) sanitize(tags map[string]string) (map[string]string, error) {
+	res := map[string]string{}
+	from := map[string]string{}
+	for _, k := range sortedKeys(tags) {
+		key := s.sanitizeString(k, maxTagKeyLength)
+		if prev, ok := from[key]; ok {
+			return nil, fmt.Errorf("tags %q and %q are both sanitized to %q", prev, k, key)
+		}
+		from[key] = k
+		res[key] = s.sanitizeString(tags[k], maxTagValueLength)
+	}
+	return res, nil
+}
+
+func (s *TagSanitizing) sanitizeString(str string, max int) string {
+	if s.Trim {
+		str = strings.TrimSpace(str)
+	}
+	if s.Replacement != "" {
+		str = invalidTagChars.ReplaceAllString(str, s.Replacement)
+	}
+	if s.Truncate && utf8.RuneCountInString(str) > max {
+		str = string([]rune(str)[:max])
+	}
+	return str
+}
+
+// tagLimitViolations returns every AWS tag limit the tag set breaks, in a
+// stable order. Characters are only checked with checkChars.
+func tagLimitViolations(tags map[string]string, checkChars bool) []string {
+	var res []string
+	if len(tags) > maxTags {
+		res = append(res, fmt.Sprintf("%v tags exceed the limit of %v", len(tags), maxTags))
+	}
+	for _, k := range sortedKeys(tags) {
+		v := tags[k]
+		if utf8.RuneCountInString(k) > maxTagKeyLength {
+			res = append(res, fmt.Sprintf("tag %q is longer than %v characters", k, maxTagKeyLength))
+		}
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			res = append(res, fmt.Sprintf("tag %q has a value longer than %v characters", k, maxTagValueLength))
+		}
+		if strings.HasPrefix(strings.ToLower(k), "aws:") {
+			res = append(res, fmt.Sprintf("tag %q uses the reserved prefix aws:", k))
+		}
+		if !checkChars {
+			continue
+		}
+		if invalidTagChars.MatchString(k) {
+			res = append(res, fmt.Sprintf("tag %q contains invalid characters", k))
+		}
+		if invalidTagChars.MatchString(v) {
+			res = append(res, fmt.Sprintf("tag %q has value %q, which contains invalid characters", k, v))
+		}
+	}
+	return res
+}
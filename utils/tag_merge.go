@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MergeStrategy decides which value a tag keeps when the user and the auto
+// tags both declare its key.
+type MergeStrategy int
+
+const (
+	// AutoTagsWin overwrites the user's value with the auto tag. This is the
+	// default.
+	AutoTagsWin MergeStrategy = iota
+	// UserTagsWin keeps the user's value, so single resources can override an
+	// auto tag.
+	UserTagsWin
+	// ErrorOnConflict fails the resource when the two values differ.
+	ErrorOnConflict
+)
+
+// WithMergeStrategy sets how conflicts between user and auto tags are
+// resolved.
+func WithMergeStrategy(strategy MergeStrategy) AutoTagOption {
+	return func(o *autoTagOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithCaseInsensitiveKeys treats keys that only differ in case, such as
+// `environment` and `Environment`, as the same tag. The spelling of the
+// winning side is kept.
+func WithCaseInsensitiveKeys() AutoTagOption {
+	return func(o *autoTagOptions) {
+		o.caseInsensitive = true
+	}
+}
+
+// mergeTags overlays autoTags on userTags following the strategy.
+func mergeTags(userTags, autoTags map[string]string, strategy MergeStrategy, caseInsensitive bool) (map[string]string, error) {
+	normalise := func(k string) string {
+		if caseInsensitive {
+			return strings.ToLower(k)
+		}
+		return k
+	}
+
+	merged := map[string]string{}
+	keys := map[string]string{}
+	for k, v := range userTags {
+		merged[k] = v
+		keys[normalise(k)] = k
+	}
+
+	var conflicts []string
+	for _, k := range sortedKeys(autoTags) {
+		v := autoTags[k]
+		if userKey, ok := keys[normalise(k)]; ok {
+			switch strategy {
+			case UserTagsWin:
+				continue
+			case ErrorOnConflict:
+				if merged[userKey] != v {
+					conflicts = append(conflicts, fmt.Sprintf("tag %q is %q, auto tag %q is %q",
+						userKey, merged[userKey], k, v))
+				}
+				continue
+			}
+			delete(merged, userKey)
+		}
+		merged[k] = v
+		keys[normalise(k)] = k
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting tags: %v", strings.Join(conflicts, "; "))
+	}
+	return merged, nil
+}
@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
+	"github.com/pulumi/pulumi/sdk/v2/go/common/tokens"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// TagPolicy declares the tag set every taggable resource must end up with
+// once the auto tags have been merged into the user supplied ones.
+type TagPolicy struct {
+	// Required keys must be present with a non-empty value.
+	Required []string `json:"required"`
+	// Allowed restricts the values of a key to a fixed set.
+	Allowed map[string][]string `json:"allowed"`
+	// Patterns restricts the values of a key to a regular expression, which
+	// must match the whole value.
+	Patterns map[string]string `json:"patterns"`
+	// Forbidden keys must not be present at all.
+	Forbidden []string `json:"forbidden"`
+}
+
+type compiledTagPolicy struct {
+	TagPolicy
+	patterns        map[string]*regexp.Regexp
+	caseInsensitive bool
+}
+
+// compile prepares the policy for checking tag sets. With caseInsensitive,
+// the keys the policy names match tag keys regardless of case, as they do
+// when merging.
+func (p TagPolicy) compile(caseInsensitive bool) (*compiledTagPolicy, error) {
+	patterns := map[string]*regexp.Regexp{}
+	for k, expr := range p.Patterns {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("tag policy: invalid pattern for tag %q: %w", k, err)
+		}
+		patterns[k] = re
+	}
+	return &compiledTagPolicy{TagPolicy: p, patterns: patterns, caseInsensitive: caseInsensitive}, nil
+}
+
+// lookup returns the value of tag k.
+func (p *compiledTagPolicy) lookup(tags map[string]string, k string) (string, bool) {
+	if v, ok := tags[k]; ok || !p.caseInsensitive {
+		return v, ok
+	}
+	for _, key := range sortedKeys(tags) {
+		if strings.EqualFold(key, k) {
+			return tags[key], true
+		}
+	}
+	return "", false
+}
+
+// violations returns every rule of the policy the given tag set breaks,
+// in a stable order.
+func (p *compiledTagPolicy) violations(tags map[string]string) []string {
+	var res []string
+	for _, k := range p.Required {
+		if v, _ := p.lookup(tags, k); v == "" {
+			res = append(res, fmt.Sprintf("required tag %q is missing", k))
+		}
+	}
+	for _, k := range p.Forbidden {
+		if _, ok := p.lookup(tags, k); ok {
+			res = append(res, fmt.Sprintf("tag %q is forbidden", k))
+		}
+	}
+	for _, k := range sortedKeys(p.Allowed) {
+		v, ok := p.lookup(tags, k)
+		if ok && !contains(p.Allowed[k], v) {
+			res = append(res, fmt.Sprintf("tag %q has value %q, allowed values are [%v]",
+				k, v, strings.Join(p.Allowed[k], ", ")))
+		}
+	}
+	for _, k := range sortedKeys(p.Patterns) {
+		v, ok := p.lookup(tags, k)
+		if ok && !p.patterns[k].MatchString(v) {
+			res = append(res, fmt.Sprintf("tag %q has value %q, which does not match %q",
+				k, v, p.Patterns[k]))
+		}
+	}
+	return res
+}
+
+// check fails, naming the resource, when the tag set violates the policy.
+func (p *compiledTagPolicy) check(urn string, tags map[string]string) error {
+	if v := p.violations(tags); len(v) > 0 {
+		return fmt.Errorf("tag policy violated by %v: %v", urn, strings.Join(v, "; "))
+	}
+	return nil
+}
+
+// resourceURN predicts the URN of the resource being transformed, which is
+// not known to the engine until the resource has been registered.
+func resourceURN(ctx *plm.Context, args *plm.ResourceTransformationArgs) plm.StringOutput {
+	newURN := func(parentType tokens.Type) string {
+		return string(resource.NewURN(tokens.QName(ctx.Stack()), tokens.PackageName(ctx.Project()),
+			parentType, tokens.Type(args.Type), tokens.QName(args.Name)))
+	}
+
+	parent := parentOf(args.Opts)
+	if parent == nil {
+		return plm.String(newURN("")).ToStringOutput()
+	}
+	return parent.URN().ApplyT(func(urn plm.URN) string {
+		parentURN := resource.URN(urn)
+		if parentURN.Type() == resource.RootStackType {
+			return newURN("")
+		}
+		return newURN(parentURN.QualifiedType())
+	}).(plm.StringOutput)
+}
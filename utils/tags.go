@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/autoscaling"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/ec2"
+	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
+)
+
+// AutoTagOption customises how RegisterAutoTags treats the tags it merges.
+type AutoTagOption func(*autoTagOptions)
+
+type autoTagOptions struct {
+	policy          *TagPolicy
+	strategy        MergeStrategy
+	caseInsensitive bool
+	computed        map[string]TagFunc
+	sanitizing      *TagSanitizing
+	propagateTags   bool
+}
+
+// WithTagPolicy fails the registration of any resource whose merged tags
+// violate the given policy.
+func WithTagPolicy(policy TagPolicy) AutoTagOption {
+	return func(o *autoTagOptions) {
+		o.policy = &policy
+	}
+}
+
+// WithPropagateTags makes ECS services that do not say where their tags
+// propagate from copy their own tags onto the tasks they start. Services that
+// already exist may be replaced when it is turned on.
+func WithPropagateTags() AutoTagOption {
+	return func(o *autoTagOptions) {
+		o.propagateTags = true
+	}
+}
+
+// RegisterAutoTags merges autoTags into the tags of every resource declared
+// after it. Tags of any input shape are supported; outputs, secrets and
+// unknowns are merged once their values resolve. See tagShapes for the
+// resource fields that are recognised, and WithComputedTags for tags derived
+// from each resource.
+//
+// Auto tags can only be registered once per stack; a second call fails.
+// Errors are also reported to the Pulumi CLI output. Run the program through
+// Run or RunErr to report the tag coverage and release the registration once
+// it is done.
+func RegisterAutoTags(ctx *plm.Context, autoTags plm.StringMap, opts ...AutoTagOption) error {
+	transformation, err := AutoTagTransformation(ctx, autoTags, opts...)
+	if err != nil {
+		return report(ctx, fmt.Errorf("register auto tags: %w", err))
+	}
+
+	registered, err := registerOnce(ctx, "autoTags", transformation)
+	if err != nil {
+		return report(ctx, fmt.Errorf("register auto tags: %w", err))
+	}
+	if !registered {
+		return report(ctx, errors.New("register auto tags: auto tags are already registered for this stack"))
+	}
+	return nil
+}
+
+// AutoTagTransformation returns the transformation RegisterAutoTags registers
+// for the whole stack. Pass it to a component through plm.Transformations to
+// tag only the children of that component.
+func AutoTagTransformation(ctx *plm.Context, autoTags plm.StringMap, opts ...AutoTagOption) (plm.ResourceTransformation, error) {
+	var options autoTagOptions
+	for _, o := range opts {
+		o(&options)
+	}
+
+	tagger := autoTagger{ctx: ctx, autoTags: autoTags, options: options}
+	if options.policy != nil {
+		var err error
+		if tagger.policy, err = options.policy.compile(options.caseInsensitive); err != nil {
+			return nil, err
+		}
+	}
+	return tagger.transform, nil
+}
+
+type autoTagger struct {
+	ctx      *plm.Context
+	autoTags plm.StringMap
+	options  autoTagOptions
+	policy   *compiledTagPolicy
+}
+
+// tagSetFunc turns the tags a user declared on one tag set of a resource into
+// the tags that resource is registered with.
+type tagSetFunc func(userTags map[string]string, autoTags map[string]string, urn string) (map[string]string, error)
+
+func (t *autoTagger) transform(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+	props := reflect.ValueOf(args.Props)
+	if !props.IsValid() || props.Kind() != reflect.Ptr || props.IsNil() || props.Elem().Kind() != reflect.Struct {
+		recordCoverage(t.ctx, args, untaggable)
+		return nil
+	}
+
+	autoTags := t.resourceAutoTags(args)
+	tagged, userTagged := false, false
+	for _, shape := range tagShapes {
+		field := props.Elem().FieldByName(shape.field)
+		if !field.IsValid() || field.Type() != shape.fieldType {
+			continue
+		}
+		if len(shape.types) > 0 && !contains(shape.types, args.Type) {
+			continue
+		}
+		if shape.setting && !t.options.propagateTags {
+			continue
+		}
+		if !shape.setting && !field.IsNil() {
+			userTagged = true
+		}
+		shape.apply(field, tagSetInputs{
+			autoTags: autoTags,
+			urn:      resourceURN(t.ctx, args),
+			tagSet:   t.tagSet,
+		})
+		tagged = true
+	}
+	if !tagged {
+		recordCoverage(t.ctx, args, untaggable)
+		return nil
+	}
+	if userTagged {
+		recordCoverage(t.ctx, args, alreadyTagged)
+	} else {
+		recordCoverage(t.ctx, args, autoTagged)
+	}
+
+	return &plm.ResourceTransformationResult{
+		Props: args.Props,
+		Opts:  args.Opts,
+	}
+}
+
+func (t *autoTagger) tagSet(userTags map[string]string, autoTags map[string]string, urn string) (map[string]string, error) {
+	merged, err := mergeTags(userTags, autoTags, t.options.strategy, t.options.caseInsensitive)
+	if err != nil {
+		return nil, fmt.Errorf("auto tags rejected by %v: %w", urn, err)
+	}
+
+	if t.options.sanitizing != nil {
+		if merged, err = t.options.sanitizing.sanitize(merged); err != nil {
+			return nil, fmt.Errorf("tags of %v: %w", urn, err)
+		}
+	}
+	if v := tagLimitViolations(merged, t.options.sanitizing != nil); len(v) > 0 {
+		return nil, fmt.Errorf("tags of %v exceed AWS limits: %v", urn, strings.Join(v, "; "))
+	}
+
+	if t.policy != nil {
+		if err := t.policy.check(urn, merged); err != nil {
+			return nil, err
+		}
+	}
+	return merged, nil
+}
+
+type tagSetInputs struct {
+	autoTags plm.StringMap
+	urn      plm.StringOutput
+	tagSet   tagSetFunc
+}
+
+// tagShape describes one resource field that carries tags, and how the auto
+// tags are merged into it.
+type tagShape struct {
+	field     string
+	fieldType reflect.Type
+	// types limits the shape to the given resource types, when set.
+	types []string
+	// setting marks fields that configure tagging rather than hold tags.
+	// They are only applied with WithPropagateTags.
+	setting bool
+	apply   func(field reflect.Value, in tagSetInputs)
+}
+
+var tagShapes = []tagShape{
+	{
+		field:     "Tags",
+		fieldType: reflect.TypeOf((*plm.StringMapInput)(nil)).Elem(),
+		apply:     applyMapTags,
+	},
+	{
+		field:     "Tags",
+		fieldType: reflect.TypeOf((*autoscaling.GroupTagArrayInput)(nil)).Elem(),
+		apply:     applyGroupTags,
+	},
+	{
+		field:     "TagSpecifications",
+		fieldType: reflect.TypeOf((*ec2.LaunchTemplateTagSpecificationArrayInput)(nil)).Elem(),
+		apply:     applyLaunchTemplateTagSpecifications,
+	},
+	{
+		field:     "PropagateTags",
+		fieldType: reflect.TypeOf((*plm.StringPtrInput)(nil)).Elem(),
+		types:     []string{"aws:ecs/service:Service"},
+		setting:   true,
+		apply:     applyPropagateTags,
+	},
+}
+
+// applyMapTags merges the auto tags into a plain `Tags` map.
+func applyMapTags(field reflect.Value, in tagSetInputs) {
+	var userTags plm.StringMapInput = plm.StringMap{}
+	if !field.IsNil() {
+		userTags = field.Interface().(plm.StringMapInput)
+	}
+
+	merged := plm.All(userTags, in.autoTags, in.urn).ApplyT(func(all []interface{}) (map[string]string, error) {
+		return in.tagSet(all[0].(map[string]string), all[1].(map[string]string), all[2].(string))
+	}).(plm.StringMapOutput)
+	field.Set(reflect.ValueOf(merged))
+}
+
+// applyGroupTags merges the auto tags into an autoscaling group tag list. Tags
+// added this way are propagated to the instances the group launches.
+func applyGroupTags(field reflect.Value, in tagSetInputs) {
+	var userTags autoscaling.GroupTagArrayInput = autoscaling.GroupTagArray{}
+	if !field.IsNil() {
+		userTags = field.Interface().(autoscaling.GroupTagArrayInput)
+	}
+
+	merged := plm.All(userTags, in.autoTags, in.urn).ApplyT(func(all []interface{}) ([]autoscaling.GroupTag, error) {
+		groupTags := all[0].([]autoscaling.GroupTag)
+
+		userMap := map[string]string{}
+		propagate := map[string]bool{}
+		for _, tag := range groupTags {
+			userMap[tag.Key] = tag.Value
+			propagate[tag.Key] = tag.PropagateAtLaunch
+		}
+
+		tags, err := in.tagSet(userMap, all[1].(map[string]string), all[2].(string))
+		if err != nil {
+			return nil, err
+		}
+
+		var res []autoscaling.GroupTag
+		for _, k := range sortedKeys(tags) {
+			p, ok := propagate[k]
+			res = append(res, autoscaling.GroupTag{
+				Key:               k,
+				Value:             tags[k],
+				PropagateAtLaunch: p || !ok,
+			})
+		}
+		return res, nil
+	}).(autoscaling.GroupTagArrayOutput)
+	field.Set(reflect.ValueOf(merged))
+}
+
+// launchTemplateTagTypes are the resource types a launch template tags when
+// it declares no tag specifications of its own.
+var launchTemplateTagTypes = []string{"instance", "volume", "network-interface"}
+
+// applyLaunchTemplateTagSpecifications merges the auto tags into every tag
+// specification of a launch template, adding specifications for instances,
+// volumes and network interfaces when there are none.
+func applyLaunchTemplateTagSpecifications(field reflect.Value, in tagSetInputs) {
+	var userSpecs ec2.LaunchTemplateTagSpecificationArrayInput = ec2.LaunchTemplateTagSpecificationArray{}
+	if !field.IsNil() {
+		userSpecs = field.Interface().(ec2.LaunchTemplateTagSpecificationArrayInput)
+	}
+
+	merged := plm.All(userSpecs, in.autoTags, in.urn).ApplyT(func(all []interface{}) ([]ec2.LaunchTemplateTagSpecification, error) {
+		specs := all[0].([]ec2.LaunchTemplateTagSpecification)
+		if len(specs) == 0 {
+			for _, t := range launchTemplateTagTypes {
+				resourceType := t
+				specs = append(specs, ec2.LaunchTemplateTagSpecification{ResourceType: &resourceType})
+			}
+		}
+
+		var res []ec2.LaunchTemplateTagSpecification
+		for _, spec := range specs {
+			tags, err := in.tagSet(spec.Tags, all[1].(map[string]string), all[2].(string))
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, ec2.LaunchTemplateTagSpecification{
+				ResourceType: spec.ResourceType,
+				Tags:         tags,
+			})
+		}
+		return res, nil
+	}).(ec2.LaunchTemplateTagSpecificationArrayOutput)
+	field.Set(reflect.ValueOf(merged))
+}
+
+// applyPropagateTags makes an ECS service copy its tags onto the tasks it
+// starts, unless the user already chose where tags propagate from.
+func applyPropagateTags(field reflect.Value, _ tagSetInputs) {
+	if field.IsNil() {
+		field.Set(reflect.ValueOf(plm.StringPtr("SERVICE")))
+	}
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
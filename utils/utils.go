@@ -1,64 +1,105 @@
 package utils
 
 import (
-	"log"
-	"reflect"
+	"fmt"
+	"regexp"
+	"strings"
 
 	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
 )
 
-func IgnoreChanges(ctx *plm.Context, global bool, types []string, props []string) {
-	err := ctx.RegisterStackTransformation(
-		func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
-			if global || contains(types, args.Type) {
-				return &plm.ResourceTransformationResult{
-					Props: args.Props,
-					Opts:  append(args.Opts, plm.IgnoreChanges(props)),
-				}
-			}
-			return nil
-		})
-	if err != nil {
-		log.Fatal(err)
+// IgnoreChanges makes every resource declared after it, or only those whose
+// type matches one of the type patterns, ignore changes to props. See
+// IgnoreChangesByType for the pattern syntax. Registering the same rule twice
+// is a no-op. Errors are also reported to the Pulumi CLI output.
+func IgnoreChanges(ctx *plm.Context, global bool, types []string, props []string) error {
+	return IgnoreChangesByType(ctx, ignoredByType(global, types, props))
+}
+
+// IgnoreChangesByType makes every resource declared after it ignore changes to
+// the props listed under each type pattern its type matches. In a pattern `*`
+// matches any run of characters, so `aws:ecs/*` matches every ECS resource
+// and `aws:codepipeline/*:*` every CodePipeline one.
+func IgnoreChangesByType(ctx *plm.Context, props map[string][]string) error {
+	key := fmt.Sprintf("ignoreChanges:%q", props)
+	if _, err := registerOnce(ctx, key, IgnoreChangesByTypeTransformation(props)); err != nil {
+		return report(ctx, fmt.Errorf("register ignore changes: %w", err))
 	}
+	return nil
 }
 
-func RegisterAutoTags(ctx *plm.Context, autoTags plm.StringMap) {
-	err := ctx.RegisterStackTransformation(
-		func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
-			ptr := reflect.ValueOf(args.Props)
-			if ptr.IsValid() {
-				val := ptr.Elem()
-				tags := val.FieldByName("Tags")
-
-				if tags.IsValid() {
-
-					var tagsMap plm.StringMap
-					if !tags.IsZero() {
-						tagsMap = tags.Interface().(plm.StringMap)
-					} else {
-						tagsMap = map[string]plm.StringInput{}
-					}
-					for k, v := range autoTags {
-						tagsMap[k] = v
-					}
-					tags.Set(reflect.ValueOf(tagsMap))
-
-					return &plm.ResourceTransformationResult{
-						Props: args.Props,
-						Opts:  args.Opts,
-					}
-				} else {
-					return nil
-				}
-			}
+// IgnoreChangesTransformation returns the transformation IgnoreChanges
+// registers for the whole stack. Components should pass IgnoreChangesOptions
+// to their children instead, see AutoTagConfig.ResourceOptions.
+func IgnoreChangesTransformation(global bool, types []string, props []string) plm.ResourceTransformation {
+	return IgnoreChangesByTypeTransformation(ignoredByType(global, types, props))
+}
+
+// IgnoreChangesByTypeTransformation returns the transformation
+// IgnoreChangesByType registers for the whole stack.
+func IgnoreChangesByTypeTransformation(props map[string][]string) plm.ResourceTransformation {
+	patterns := map[string]*regexp.Regexp{}
+	for p := range props {
+		patterns[p] = compilePattern(p)
+	}
+
+	return func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+		ignored := ignoredByPatterns(props, patterns, args.Type)
+		if len(ignored) == 0 {
 			return nil
-		},
-	)
+		}
+
+		return &plm.ResourceTransformationResult{
+			Props: args.Props,
+			Opts:  append(args.Opts, plm.IgnoreChanges(ignored)),
+		}
+	}
+}
 
-	if err != nil {
-		log.Fatal(err)
+// IgnoreChangesOptions returns the options IgnoreChanges gives a resource of
+// type t.
+func IgnoreChangesOptions(global bool, types []string, props []string, t string) []plm.ResourceOption {
+	byType := ignoredByType(global, types, props)
+	patterns := map[string]*regexp.Regexp{}
+	for p := range byType {
+		patterns[p] = compilePattern(p)
 	}
+
+	ignored := ignoredByPatterns(byType, patterns, t)
+	if len(ignored) == 0 {
+		return nil
+	}
+	return []plm.ResourceOption{plm.IgnoreChanges(ignored)}
+}
+
+// ignoredByPatterns returns the props listed under every type pattern t matches.
+func ignoredByPatterns(props map[string][]string, patterns map[string]*regexp.Regexp, t string) []string {
+	var ignored []string
+	for _, p := range sortedKeys(props) {
+		if patterns[p].MatchString(t) {
+			ignored = append(ignored, props[p]...)
+		}
+	}
+	return ignored
+}
+
+func ignoredByType(global bool, types []string, props []string) map[string][]string {
+	if global {
+		return map[string][]string{"*": props}
+	}
+
+	byType := map[string][]string{}
+	for _, t := range types {
+		byType[t] = append(byType[t], props...)
+	}
+	return byType
+}
+
+// compilePattern turns a pattern, in which `*` matches any run of characters,
+// into a regular expression matching whole strings.
+func compilePattern(pattern string) *regexp.Regexp {
+	expr := strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*")
+	return regexp.MustCompile("^" + expr + "$")
 }
 
 func ToPulumiStringArray(a []string) plm.StringArrayInput {
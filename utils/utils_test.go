@@ -1,11 +1,16 @@
 package utils
 
 import (
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/autoscaling"
 	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/cloudfront"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/ec2"
+	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/ecs"
 	"github.com/pulumi/pulumi-aws/sdk/v3/go/aws/s3"
 	"github.com/pulumi/pulumi/sdk/v2/go/common/resource"
 	plm "github.com/pulumi/pulumi/sdk/v2/go/pulumi"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
 	"sync"
 	"testing"
 )
@@ -21,10 +26,10 @@ func (mocks) Call(token string, args resource.PropertyMap, provider string) (res
 }
 
 func TestRegisterAutoTags(t *testing.T) {
-	err := plm.RunErr(func(ctx *plm.Context) error {
-		RegisterAutoTags(ctx, plm.StringMap{
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
 			"Environment": plm.String("test"),
-		})
+		}))
 		taggable, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
 			Tags: plm.StringMap{
 				"Env": plm.String("test"),
@@ -38,6 +43,12 @@ func TestRegisterAutoTags(t *testing.T) {
 		_, err = cloudfront.NewOriginAccessIdentity(ctx, "originAccessIdentity", &cloudfront.OriginAccessIdentityArgs{})
 		assert.NoError(t, err)
 
+		assert.Equal(t, TagCoverage{
+			"aws:s3/bucket:Bucket": {Tagged: 1, AlreadyTagged: 1},
+			"aws:cloudfront/originAccessIdentity:OriginAccessIdentity": {Untaggable: 1},
+		}, GetTagCoverage(ctx))
+		assert.NoError(t, ReportTagCoverage(ctx))
+
 		var wg sync.WaitGroup
 		wg.Add(1)
 
@@ -59,3 +70,623 @@ func TestRegisterAutoTags(t *testing.T) {
 	}, plm.WithMocks("project", "stack", mocks(0)))
 	assert.NoError(t, err)
 }
+
+func TestRegisterAutoTagsPolicy(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}, WithTagPolicy(TagPolicy{
+			Required:  []string{"Environment"},
+			Allowed:   map[string][]string{"Environment": {"dev", "test", "prod"}},
+			Forbidden: []string{"Enviroment"},
+		})))
+
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+			Tags: plm.StringMap{
+				"Enviroment": plm.String("test"),
+			},
+		})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "urn:pulumi:stack::project::aws:s3/bucket:Bucket::bucket")
+	assert.Contains(t, err.Error(), `tag "Enviroment" is forbidden`)
+}
+
+func TestTagPolicyViolations(t *testing.T) {
+	policy := TagPolicy{
+		Required: []string{"Environment"},
+		Allowed:  map[string][]string{"Environment": {"dev", "prod"}},
+		Patterns: map[string]string{"CostCenter": "[0-9]+"},
+	}
+
+	p, err := policy.compile(false)
+	assert.NoError(t, err)
+	assert.Empty(t, p.violations(map[string]string{"Environment": "dev", "CostCenter": "42"}))
+	assert.Equal(t, []string{
+		`tag "CostCenter" has value "cc-42", which does not match "[0-9]+"`,
+	}, p.violations(map[string]string{"Environment": "dev", "CostCenter": "cc-42"}))
+	assert.Equal(t, []string{
+		`required tag "Environment" is missing`,
+	}, p.violations(map[string]string{"environment": "dev"}))
+
+	p, err = policy.compile(true)
+	assert.NoError(t, err)
+	assert.Empty(t, p.violations(map[string]string{"environment": "prod"}))
+	assert.Equal(t, []string{
+		`tag "Environment" has value "test", allowed values are [dev, prod]`,
+	}, p.violations(map[string]string{"ENVIRONMENT": "test"}))
+}
+
+func TestRegisterAutoTagsOutput(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}))
+		source, err := s3.NewBucket(ctx, "source", &s3.BucketArgs{
+			Tags: plm.StringMap{
+				"Env": plm.String("test"),
+			},
+		})
+		assert.NoError(t, err)
+
+		fromOutput, err := s3.NewBucket(ctx, "bucket-output", &s3.BucketArgs{
+			Tags: source.Tags,
+		})
+		assert.NoError(t, err)
+
+		fromSecret, err := s3.NewBucket(ctx, "bucket-secret", &s3.BucketArgs{
+			Tags: plm.ToSecret(plm.StringMap{
+				"Owner": plm.String("test"),
+			}).(plm.StringMapOutput),
+		})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		plm.All(fromOutput.Tags, fromSecret.Tags).ApplyT(func(all []interface{}) error {
+			tags := all[0].(map[string]string)
+			secretTags := all[1].(map[string]string)
+
+			assert.Containsf(t, tags, "Environment", "missing a Environment tag")
+			assert.Containsf(t, tags, "Env", "missing a Env tag")
+			assert.Containsf(t, secretTags, "Environment", "missing a Environment tag")
+			assert.Containsf(t, secretTags, "Owner", "missing a Owner tag")
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsShapes(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}, WithPropagateTags()))
+		group, err := autoscaling.NewGroup(ctx, "group", &autoscaling.GroupArgs{
+			MaxSize: plm.Int(1),
+			MinSize: plm.Int(1),
+			Tags: autoscaling.GroupTagArray{
+				autoscaling.GroupTagArgs{
+					Key:               plm.String("Env"),
+					Value:             plm.String("test"),
+					PropagateAtLaunch: plm.Bool(false),
+				},
+			},
+		})
+		assert.NoError(t, err)
+
+		template, err := ec2.NewLaunchTemplate(ctx, "template", &ec2.LaunchTemplateArgs{})
+		assert.NoError(t, err)
+
+		svc, err := ecs.NewService(ctx, "service", &ecs.ServiceArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		plm.All(group.Tags, template.TagSpecifications, svc.PropagateTags).ApplyT(func(all []interface{}) error {
+			assert.Equal(t, []autoscaling.GroupTag{
+				{Key: "Env", Value: "test", PropagateAtLaunch: false},
+				{Key: "Environment", Value: "test", PropagateAtLaunch: true},
+			}, all[0])
+
+			specs := all[1].([]ec2.LaunchTemplateTagSpecification)
+			assert.Len(t, specs, 3)
+			for _, spec := range specs {
+				assert.Containsf(t, spec.Tags, "Environment", "missing a Environment tag")
+			}
+
+			assert.Equal(t, "SERVICE", *all[2].(*string))
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsNoPropagateTags(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}))
+		svc, err := ecs.NewService(ctx, "service", &ecs.ServiceArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		plm.All(svc.Tags, svc.PropagateTags).ApplyT(func(all []interface{}) error {
+			assert.Containsf(t, all[0], "Environment", "missing a Environment tag")
+			assert.Nil(t, all[1])
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsUserTagsWin(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+			"Team":        plm.String("dev"),
+		}, WithMergeStrategy(UserTagsWin), WithCaseInsensitiveKeys()))
+		bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+			Tags: plm.StringMap{
+				"team": plm.String("data"),
+			},
+		})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		bucket.Tags.ApplyT(func(tags map[string]string) error {
+			assert.Equal(t, map[string]string{
+				"Environment": "test",
+				"team":        "data",
+			}, tags)
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsErrorOnConflict(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Team": plm.String("dev"),
+		}, WithMergeStrategy(ErrorOnConflict)))
+
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+			Tags: plm.StringMap{
+				"Team": plm.String("data"),
+			},
+		})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "urn:pulumi:stack::project::aws:s3/bucket:Bucket::bucket")
+	assert.Contains(t, err.Error(), `tag "Team" is "data", auto tag "Team" is "dev"`)
+}
+
+func TestRegisterAutoTagsComputed(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}, WithComputedTags(PulumiResourceTags())))
+		bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		bucket.Tags.ApplyT(func(tags map[string]string) error {
+			assert.Equal(t, map[string]string{
+				"Environment":   "test",
+				"Name":          "bucket",
+				"PulumiProject": "project",
+				"PulumiStack":   "stack",
+				"PulumiType":    "aws:s3/bucket:Bucket",
+				"PulumiUrn":     "urn:pulumi:stack::project::aws:s3/bucket:Bucket::bucket",
+			}, tags)
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsComputedKeepsName(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{},
+			WithComputedTags(PulumiResourceTags())))
+		named, err := s3.NewBucket(ctx, "named", &s3.BucketArgs{
+			Tags: plm.StringMap{"Name": plm.String("console-name")},
+		})
+		assert.NoError(t, err)
+		fromOutput, err := s3.NewBucket(ctx, "from-output", &s3.BucketArgs{
+			Tags: named.Tags,
+		})
+		assert.NoError(t, err)
+		unnamed, err := s3.NewBucket(ctx, "unnamed", &s3.BucketArgs{
+			Tags: plm.StringMap{"Owner": plm.String("dev")},
+		})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		plm.All(named.Tags, fromOutput.Tags, unnamed.Tags).ApplyT(func(all []interface{}) error {
+			assert.Equal(t, "console-name", all[0].(map[string]string)["Name"])
+			assert.Equal(t, "console-name", all[1].(map[string]string)["Name"])
+			assert.Equal(t, "unnamed", all[2].(map[string]string)["Name"])
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterAutoTagsComponentUrn(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		// Sanitizing without a replacement fails on any invalid character.
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{},
+			WithComputedTags(PulumiResourceTags()), WithTagSanitizing(TagSanitizing{})))
+
+		var component plm.ResourceState
+		assert.NoError(t, ctx.RegisterComponentResource("test:index:component", "component", &component))
+		bucket, err := s3.NewBucket(ctx, "child", &s3.BucketArgs{}, plm.Parent(&component))
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		bucket.Tags.ApplyT(func(tags map[string]string) error {
+			assert.Equal(t, "urn:pulumi:stack::project::test:index:component_aws:s3/bucket:Bucket::child",
+				tags["PulumiUrn"])
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+
+	long := strings.Repeat("a", 300)
+	assert.Equal(t, long[44:], urnTagValue(long))
+}
+
+func TestRegisterAutoTagsFromConfig(t *testing.T) {
+	assert.NoError(t, os.Setenv("PULUMI_CONFIG", `{
+		"dulumi:tags": "{\"Team\": \"platform\", \"CostCenter\": \"1234\"}",
+		"dulumi:tagPolicy": "{\"required\": [\"Team\", \"CostCenter\"]}"
+	}`))
+	defer os.Unsetenv("PULUMI_CONFIG")
+
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTagsFromConfig(ctx, "dulumi"))
+		bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		bucket.Tags.ApplyT(func(tags map[string]string) error {
+			assert.Equal(t, map[string]string{
+				"Team":       "platform",
+				"CostCenter": "1234",
+			}, tags)
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestAutoTagTransformationScoped(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		tagging, err := AutoTagTransformation(ctx, plm.StringMap{
+			"Service": plm.String("api"),
+		})
+		assert.NoError(t, err)
+
+		var component plm.ResourceState
+		err = ctx.RegisterComponentResource("test:index:component", "component", &component,
+			plm.Transformations([]plm.ResourceTransformation{tagging}))
+		assert.NoError(t, err)
+
+		child, err := s3.NewBucket(ctx, "child", &s3.BucketArgs{}, plm.Parent(&component))
+		assert.NoError(t, err)
+
+		sibling, err := s3.NewBucket(ctx, "sibling", &s3.BucketArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		plm.All(child.Tags, sibling.Tags).ApplyT(func(all []interface{}) error {
+			assert.Equal(t, map[string]string{"Service": "api"}, all[0])
+			assert.NotContainsf(t, all[1], "Service", "should be missing a Service tag")
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRegisterTwice(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		autoTags := plm.StringMap{
+			"Environment": plm.String("test"),
+		}
+		assert.NoError(t, RegisterAutoTags(ctx, autoTags))
+		assert.EqualError(t, RegisterAutoTags(ctx, autoTags),
+			"register auto tags: auto tags are already registered for this stack")
+
+		for i := 0; i < 2; i++ {
+			assert.NoError(t, IgnoreChanges(ctx, false, []string{"aws:s3/bucket:Bucket"}, []string{"tags"}))
+		}
+		assert.Len(t, registrations.byContext[ctx].keys, 2)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestTagCoverageCountsOnce(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}))
+		tagging, err := AutoTagTransformation(ctx, plm.StringMap{
+			"Service": plm.String("api"),
+		})
+		assert.NoError(t, err)
+
+		var component plm.ResourceState
+		assert.NoError(t, ctx.RegisterComponentResource("test:index:component", "component", &component,
+			plm.Transformations([]plm.ResourceTransformation{tagging})))
+		_, err = s3.NewBucket(ctx, "child", &s3.BucketArgs{}, plm.Parent(&component))
+		assert.NoError(t, err)
+
+		assert.Equal(t, TagCoverage{
+			"aws:s3/bucket:Bucket": {Tagged: 1},
+		}, GetTagCoverage(ctx))
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestRunErrReleases(t *testing.T) {
+	var ctx *plm.Context
+	err := RunErr(func(c *plm.Context) error {
+		ctx = c
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}))
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+		assert.NotEmpty(t, GetTagCoverage(ctx))
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+
+	assert.NotContains(t, registrations.byContext, ctx)
+	assert.NotContains(t, coverage.byContext, ctx)
+}
+
+func TestRegisterAutoTagsSanitizing(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Owner": plm.String(" team#dev "),
+		}, WithTagSanitizing(TagSanitizing{Trim: true, Replacement: "-"})))
+		bucket, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+
+		bucket.Tags.ApplyT(func(tags map[string]string) error {
+			assert.Equal(t, map[string]string{"Owner": "team-dev"}, tags)
+			wg.Done()
+			return nil
+		})
+
+		wg.Wait()
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestTagSanitizingCollision(t *testing.T) {
+	s := TagSanitizing{Trim: true}
+	_, err := s.sanitize(map[string]string{"Team": "dev", "Team ": "ops"})
+	assert.EqualError(t, err, `tags "Team" and "Team " are both sanitized to "Team"`)
+
+	tags, err := s.sanitize(map[string]string{"Team ": " dev "})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"Team": "dev"}, tags)
+}
+
+func TestRegisterAutoTagsLimits(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, plm.StringMap{
+			"Environment": plm.String("test"),
+		}))
+
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+			Tags: plm.StringMap{
+				"aws:owner": plm.String("dev"),
+			},
+		})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "urn:pulumi:stack::project::aws:s3/bucket:Bucket::bucket")
+	assert.Contains(t, err.Error(), `tag "aws:owner" uses the reserved prefix aws:`)
+}
+
+func TestRegisterAutoTagsInvalidChars(t *testing.T) {
+	tags := plm.StringMap{"Owner": plm.String("team#dev")}
+	err := RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, tags))
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+
+	err = RunErr(func(ctx *plm.Context) error {
+		assert.NoError(t, RegisterAutoTags(ctx, tags, WithTagSanitizing(TagSanitizing{Trim: true})))
+		_, err := s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), `tag "Owner" has value "team#dev", which contains invalid characters`)
+}
+
+func TestIgnoreChangesByType(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		ignored := map[string][]string{}
+		assert.NoError(t, ctx.RegisterStackTransformation(ChainTransformations(
+			IgnoreChangesTransformation(false, []string{"aws:ecs/*"}, []string{"tags"}),
+			IgnoreChangesByTypeTransformation(map[string][]string{
+				"aws:ecs/service:Service": {"taskDefinition"},
+				"aws:codepipeline/*:*":    {"oAuthToken"},
+			}),
+			func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+				ignored[args.Name] = ignoredProps(args.Opts)
+				return nil
+			},
+		)))
+
+		_, err := ecs.NewService(ctx, "service", &ecs.ServiceArgs{})
+		assert.NoError(t, err)
+		_, err = ecs.NewCluster(ctx, "cluster", &ecs.ClusterArgs{})
+		assert.NoError(t, err)
+		_, err = s3.NewBucket(ctx, "bucket", &s3.BucketArgs{})
+		assert.NoError(t, err)
+
+		assert.Equal(t, map[string][]string{
+			"service": {"tags", "taskDefinition"},
+			"cluster": {"tags"},
+			"bucket":  nil,
+		}, ignored)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+// ignoredProps replays opts to collect the props they ignore.
+func ignoredProps(opts []plm.ResourceOption) []string {
+	var props []string
+	for _, v := range OptionValues(opts, "IgnoreChanges") {
+		props = append(props, v.([]string)...)
+	}
+	return props
+}
+
+func TestResourceRulesTransformation(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		options := map[string][]plm.ResourceOption{}
+		assert.NoError(t, ctx.RegisterStackTransformation(ChainTransformations(
+			ResourceRulesTransformation(ctx, ResourceRule{
+				Types:   []string{"aws:s3/*"},
+				Stacks:  []string{"st*"},
+				Protect: true,
+			}, ResourceRule{
+				Parents:       []string{"test:index:*"},
+				Tags:          map[string]string{"Environment": "prod"},
+				IgnoreChanges: []string{"acl"},
+			}),
+			func(args *plm.ResourceTransformationArgs) *plm.ResourceTransformationResult {
+				options[args.Name] = args.Opts
+				return nil
+			},
+		)))
+
+		var component plm.ResourceState
+		assert.NoError(t, ctx.RegisterComponentResource("test:index:component", "component", &component))
+
+		_, err := s3.NewBucket(ctx, "child", &s3.BucketArgs{
+			Tags: plm.StringMap{"Environment": plm.String("prod")},
+		}, plm.Parent(&component))
+		assert.NoError(t, err)
+		_, err = s3.NewBucket(ctx, "bucket", &s3.BucketArgs{
+			Tags: plm.StringMap{"Environment": plm.String("prod")},
+		})
+		assert.NoError(t, err)
+		_, err = ecs.NewCluster(ctx, "cluster", &ecs.ClusterArgs{})
+		assert.NoError(t, err)
+
+		assert.Contains(t, OptionValues(options["child"], "Protect"), true)
+		assert.Equal(t, []string{"acl"}, ignoredProps(options["child"]))
+		assert.Contains(t, OptionValues(options["bucket"], "Protect"), true)
+		assert.Empty(t, ignoredProps(options["bucket"]))
+		assert.NotContains(t, OptionValues(options["cluster"], "Protect"), true)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}
+
+func TestAutoTagConfigResourceOptions(t *testing.T) {
+	err := RunErr(func(ctx *plm.Context) error {
+		c := AutoTagConfig{
+			IgnoreChanges: []IgnoreRule{
+				{Types: []string{"aws:ecs/*"}, Props: []string{"desiredCount"}},
+				{Global: true, Props: []string{"oAuthToken"}},
+			},
+			ResourceRules: []ResourceRule{
+				{Parents: []string{"test:index:component"}, Names: []string{"*-repo"}, Protect: true},
+				{Tags: map[string]string{"Environment": "prod"}, DeleteBeforeReplace: true},
+			},
+		}
+
+		opts := c.ResourceOptions(ctx, "aws:ecs/service:Service", "api-service", "test:index:component")
+		assert.Equal(t, []string{"desiredCount", "oAuthToken"}, ignoredProps(opts))
+		assert.NotContains(t, OptionValues(opts, "Protect"), true)
+
+		opts = c.ResourceOptions(ctx, "aws:ecr/repository:Repository", "api-repo", "test:index:component")
+		assert.Equal(t, []string{"oAuthToken"}, ignoredProps(opts))
+		assert.Contains(t, OptionValues(opts, "Protect"), true)
+		assert.NotContains(t, OptionValues(opts, "DeleteBeforeReplace"), true)
+
+		opts = c.ResourceOptions(ctx, "aws:ecr/repository:Repository", "api-repo", "")
+		assert.NotContains(t, OptionValues(opts, "Protect"), true)
+		return nil
+	}, plm.WithMocks("project", "stack", mocks(0)))
+	assert.NoError(t, err)
+}